@@ -0,0 +1,164 @@
+// Package bench runs concurrent transfers through the transfer service in this process,
+// it is shared by the bench command and the service benchmarks
+package bench
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/eqr/transferit/app/config"
+	"github.com/eqr/transferit/app/service"
+)
+
+type Options struct {
+	Transfers       int // concurrent transfers, each has a sender and a receiver
+	Chunks          int // chunks per transfer
+	ChunkSize       int
+	WindowSize      int
+	StoreAndForward bool
+}
+
+// Bench is the service with the transfers ready to start
+type Bench struct {
+	opts   Options
+	srv    *service.Service
+	db     *bolt.DB
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the flusher has stopped
+	data   []byte
+	ids    []service.TransferID
+}
+
+// New creates the service in dir with the db opened like on the server, so every commit is synced,
+// and inits the transfers. Users are not checked, the bench measures transfers only.
+func New(dir string, opts Options) (*Bench, error) {
+	db, err := bolt.Open(filepath.Join(dir, "bench.db"), 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open bench db: %w", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Transfer.WindowSize = opts.WindowSize
+	cfg.Transfer.MaxChunkSize = opts.ChunkSize
+	cfg.Transfer.StoreAndForward = opts.StoreAndForward
+	cfg.WorkDir.Path = filepath.Join(dir, "chunks")
+
+	srv, err := service.New(cfg, db, nil)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// progress is saved in the background like on the server
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.RunFlusher(ctx, time.Second)
+	}()
+
+	b := &Bench{opts: opts, srv: srv, db: db, cancel: cancel, done: done, data: make([]byte, opts.ChunkSize)}
+	if _, err := rand.Read(b.data); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("cannot generate chunk: %w", err)
+	}
+
+	b.ids = make([]service.TransferID, opts.Transfers)
+	for i := range b.ids {
+		request := &service.InitUploadRequest{
+			NumOfChunks:     opts.Chunks,
+			StoreAndForward: opts.StoreAndForward,
+			Digest:          service.Digest(b.data),
+			Metadata:        service.Metadata{Name: fmt.Sprintf("bench-%d", i), Size: int64(opts.Chunks) * int64(opts.ChunkSize), ChunkSize: opts.ChunkSize},
+		}
+
+		var response service.InitUploadResponse
+		if err := srv.InitUpload(request, &response); err != nil {
+			b.Close()
+			return nil, err
+		}
+
+		b.ids[i] = response.TransferID
+	}
+
+	return b, nil
+}
+
+// Close saves the progress and closes the db
+func (b *Bench) Close() {
+	b.cancel()
+	<-b.done
+	b.db.Close()
+}
+
+// Run sends every transfer and waits until all of them are received
+func (b *Bench) Run() error {
+	failed := make(chan error, 2*len(b.ids))
+	var wg sync.WaitGroup
+
+	run := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(); err != nil {
+				failed <- err
+			}
+		}()
+	}
+
+	for _, id := range b.ids {
+		id := id
+		run(func() error { return b.send(id) })
+		run(func() error { return b.receive(id) })
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-failed:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (b *Bench) send(id service.TransferID) error {
+	digest := service.Digest(b.data)
+	for number := 0; number < b.opts.Chunks; number++ {
+		request := &service.UploadChunkRequest{
+			TransferID:  id.String(),
+			ChunkNumber: number,
+			Payload:     b.data,
+			Digest:      digest,
+			Timeout:     time.Minute,
+		}
+
+		if err := b.srv.UploadChunk(request, &service.UploadChunkResponse{}); err != nil {
+			return fmt.Errorf("cannot upload chunk %d (%v): %w", number, id, err)
+		}
+	}
+
+	request := &service.CompleteUploadRequest{TransferID: id, NumOfChunks: b.opts.Chunks}
+	return b.srv.CompleteUpload(request, &service.CompleteUploadResponse{})
+}
+
+func (b *Bench) receive(id service.TransferID) error {
+	for number := 0; number < b.opts.Chunks; number++ {
+		request := &service.DownloadChunkRequest{TransferID: id, ChunkNumber: number, Raw: true, Timeout: time.Minute}
+		if err := b.srv.DownloadChunk(request, &service.DownloadChunkResponse{}); err != nil {
+			return fmt.Errorf("cannot download chunk %d (%v): %w", number, id, err)
+		}
+
+		confirm := &service.ConfirmChunkDownloadedRequest{TransferID: id, ChunkNumber: number}
+		if err := b.srv.ConfirmChunkDownloaded(confirm, &service.ConfirmChunkDownloadedResponse{}); err != nil {
+			return fmt.Errorf("cannot confirm chunk %d (%v): %w", number, id, err)
+		}
+	}
+
+	return nil
+}
@@ -1,31 +1,100 @@
 package client
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/rpc"
+	"os"
 
 	"github.com/eqr/transferit/app/service"
 )
 
 type Client struct {
 	*rpc.Client
+	token string // sent with every call, see Login
 }
 
-func Connect(url string) (*Client, error) {
-	client, err := rpc.Dial("tcp", url)
+// Connect dials the transfer endpoint, tlsConfig is nil for plain tcp
+func Connect(url string, tlsConfig *tls.Config) (*Client, error) {
+	if tlsConfig == nil {
+		client, err := rpc.Dial("tcp", url)
+		if err != nil {
+			return nil, fmt.Errorf("cannot dial to rpc service: %w", err)
+		}
+
+		return &Client{Client: client}, nil
+	}
+
+	conn, err := tls.Dial("tcp", url, tlsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("cannot dial to rpc service: %w", err)
 	}
 
-	return &Client{
-		Client: client,
-	}, nil
+	return &Client{Client: rpc.NewClient(conn)}, nil
 }
 
-func (c *Client) Upload(filePath string) error {
-	return upload(filePath, c.Client)
+// TLSConfig verifies the server with the CA file (system roots if empty)
+// and presents the client certificate if the cert and the key are set
+func TLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA %s", caFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
-func (c *Client) Download(id service.TransferID) (string, error) {
-	return download(id)
+// Upload sends the file, the transfer is cancelled on the server when ctx is done
+func (c *Client) Upload(ctx context.Context, filePath string, opts UploadOptions) error {
+	return upload(ctx, filePath, opts, c)
+}
+
+// Download receives the transfer into outputPath (the transfer id is used if empty) and returns the written path.
+// The transfer is cancelled on the server when ctx is done.
+func (c *Client) Download(ctx context.Context, id service.TransferID, outputPath string, opts DownloadOptions) (string, error) {
+	return download(ctx, id, outputPath, opts, c)
+}
+
+// Cancel stops the transfer for both sides
+func (c *Client) Cancel(id service.TransferID, reason string) error {
+	return cancelTransfer(c, id, reason)
+}
+
+// SetToken authenticates the following calls
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Login requests the token for the user, the following calls are authenticated with it
+func (c *Client) Login(login string, password string) (string, error) {
+	req := service.LoginRequest{Login: login, Password: password}
+	resp := &service.LoginResponse{}
+	if err := c.Call("Service.Login", req, resp); err != nil {
+		return "", fmt.Errorf("cannot log in as %s: %w", login, err)
+	}
+
+	c.token = resp.Token
+	return resp.Token, nil
 }
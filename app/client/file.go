@@ -1,71 +1,723 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"net/http"
 	"net/rpc"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/eqr/transferit/app/service"
+	"github.com/google/uuid"
 )
 
+// batchSize is the preferred chunk size, it is lowered to the server limit
 const batchSize = 5 * 1024 * 1024
 
-func upload(filePath string, c *rpc.Client) error {
+// pollInterval is used with servers which do not support blocking calls
+const pollInterval = 500 * time.Millisecond
+
+// defaultInFlight limits uploads when the server does not bound the window
+const defaultInFlight = 4
+
+type UploadOptions struct {
+	StoreAndForward bool               // the receiver may download the file after the sender is gone
+	Resume          service.TransferID // continue the interrupted upload, uuid.Nil to start a new one
+	Recipients      []string           // logins of the users allowed to download, any user if empty
+	Link            *LinkOptions       // print the share link once the transfer is created, nil if not needed
+}
+
+type DownloadOptions struct {
+	Resume bool // continue into the existing file from the first chunk the server has not received an ack for
+}
+
+func upload(ctx context.Context, filePath string, opts UploadOptions, c *Client) error {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("cannot open file: %w", err)
 	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot read file info: %w", err)
+	}
+
+	digest, err := fileDigest(f)
+	if err != nil {
+		return err
+	}
 
+	limitsResp, err := getServerLimits(c)
+	if err != nil {
+		return err
+	}
+
+	var id service.TransferID
 	batchNumber := 0
+	chunkSize := batchSize
+
+	if opts.Resume != uuid.Nil {
+		id = opts.Resume
+
+		resumeReq := service.ResumeUploadRequest{TransferID: id, Token: c.token}
+		resumeResp := &service.ResumeUploadResponse{}
+		if err := c.Call("Service.ResumeUpload", resumeReq, resumeResp); err != nil {
+			return fmt.Errorf("cannot resume upload %v: %w", id, err)
+		}
+
+		if !bytes.Equal(resumeResp.Digest, digest) {
+			return fmt.Errorf("file %s does not match transfer %v: digest %x expected, got %x",
+				filePath, id, resumeResp.Digest, digest)
+		}
+
+		if resumeResp.State == service.StateAwaitingAck {
+			log.Printf("upload of %v is already %s", id, resumeResp.State)
+			return nil
+		}
+
+		// the batches sent before were cut by the chunk size they were declared with
+		if resumeResp.ChunkSize <= 0 {
+			return fmt.Errorf("cannot resume upload %v: its chunk size is unknown", id)
+		}
+
+		chunkSize = resumeResp.ChunkSize
+		batchNumber = resumeResp.NextChunk
+		if _, err := f.Seek(int64(batchNumber)*int64(chunkSize), io.SeekStart); err != nil {
+			return fmt.Errorf("cannot seek file to chunk %d: %w", batchNumber, err)
+		}
+
+		log.Printf("resuming transfer %v from batch %d", id, batchNumber)
+	} else {
+		if limitsResp.MaxChunkSize > 0 && limitsResp.MaxChunkSize < chunkSize {
+			chunkSize = limitsResp.MaxChunkSize
+		}
+
+		if opts.StoreAndForward && !limitsResp.StoreAndForward {
+			return fmt.Errorf("server does not support store and forward")
+		}
 
-	initReq := &service.InitUploadRequest{}
-	initResp := &service.InitUploadResponse{}
-	err = c.Call("Service.InitUpload", initReq, initResp)
+		metadata, err := describe(f, info, chunkSize)
+		if err != nil {
+			return err
+		}
+
+		initReq := &service.InitUploadRequest{
+			NumOfChunks:     int((info.Size() + int64(chunkSize) - 1) / int64(chunkSize)),
+			StoreAndForward: opts.StoreAndForward,
+			Digest:          digest,
+			Metadata:        metadata,
+			Recipients:      opts.Recipients,
+			Token:           c.token,
+		}
+		initResp := &service.InitUploadResponse{}
+		err = c.Call("Service.InitUpload", initReq, initResp)
+		if err != nil {
+			return fmt.Errorf("cannot init upload file %s: %w", filePath, err)
+		}
+
+		id = initResp.TransferID
+		log.Println("Tranfser id: ", id)
+	}
+
+	// the link is printed before the upload, the receiver has to download while the window is full
+	if opts.Link != nil {
+		url, expiresAt, err := c.CreateLink(id, *opts.Link)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("share link, valid until %s: %s", expiresAt.Format(time.RFC3339), url)
+	}
+
+	wnd, err := getWindow(c, id)
 	if err != nil {
-		return fmt.Errorf("cannot init upload file %s: %w", filePath, err)
+		return err
+	}
+
+	// keep up to the window size of chunks in flight
+	size := wnd.Size
+	if size == 0 {
+		size = defaultInFlight
 	}
 
-	log.Println("Tranfser id: ", initResp.TransferID)
+	inFlight := make(chan struct{}, size)
+	failed := make(chan error, 1)
+	var wg sync.WaitGroup
+
+	// once interrupted, the transfer is cancelled on the server, so the receiver does not wait for the rest of the file
+	fail := func(err error) error {
+		if ctx.Err() == nil {
+			return err
+		}
+
+		wg.Wait()
+		return abort(c, id, "sender interrupted", ctx.Err())
+	}
 
 	for {
-		buf := make([]byte, batchSize)
-		_, err := f.Read(buf)
+		buf := make([]byte, chunkSize)
+		n, err := io.ReadFull(f, buf)
 
 		if err == io.EOF {
 			log.Printf("reached end of file %s", filePath)
-			return nil
+			break
 		}
 
-		if err != nil {
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return fmt.Errorf("cannot read file: %w", err)
 		}
 
-		encoded := base64.StdEncoding.EncodeToString(buf)
-		fmt.Println(encoded)
+		buf = buf[:n]
 
-		log.Printf("sending batch %d of file %s", batchNumber, filePath)
-		uploadReq := service.UploadChunkRequest{
-			TransferID:  initResp.TransferID.String(),
-			ChunkNumber: batchNumber,
-			Content:     encoded,
+		select {
+		case inFlight <- struct{}{}:
+		case err := <-failed:
+			return fail(err)
+		case <-ctx.Done():
+			return fail(ctx.Err())
 		}
 
+		wg.Add(1)
+		go func(number int) {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+
+			log.Printf("sending batch %d of file %s", number, filePath)
+			if err := sendChunk(ctx, c, id, number, buf, limitsResp); err != nil {
+				select {
+				case failed <- fmt.Errorf("cannot upload chunk %d (%v): %w", number, id, err):
+				default:
+				}
+			}
+		}(batchNumber)
+
+		batchNumber++
+	}
+
+	wg.Wait()
+	select {
+	case err := <-failed:
+		return fail(err)
+	default:
+	}
+
+	completeReq := service.CompleteUploadRequest{
+		TransferID:  id,
+		NumOfChunks: batchNumber,
+		Token:       c.token,
+	}
+	completeResp := &service.CompleteUploadResponse{}
+	if err := c.Call("Service.CompleteUpload", completeReq, completeResp); err != nil {
+		return fmt.Errorf("cannot complete upload (%v): %w", id, err)
+	}
+
+	log.Printf("upload of %v is %s", id, completeResp.State)
+	return nil
+}
+
+// sendChunk uploads the chunk, waiting while it does not fit into the window.
+// The chunk is base64 encoded for servers without raw payload support.
+func sendChunk(ctx context.Context, c *Client, id service.TransferID, number int, data []byte, limits *service.GetServerLimitsResponse) error {
+	uploadReq := service.UploadChunkRequest{
+		TransferID:  id.String(),
+		ChunkNumber: number,
+		Digest:      service.Digest(data),
+		Timeout:     limits.MaxWait,
+		Token:       c.token,
+	}
+
+	if limits.RawPayload {
+		uploadReq.Payload = data
+	} else {
+		uploadReq.Content = base64.StdEncoding.EncodeToString(data)
+	}
+
+	for {
 		uploadResp := &service.UploadChunkResponse{}
+		err := call(ctx, c.Client, "Service.UploadChunk", uploadReq, uploadResp)
+		if !service.Is(err, service.ErrWindowFull) {
+			return err
+		}
+
+		if limits.MaxWait > 0 {
+			continue
+		}
+
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// received is the chunk fetched by one of the concurrent downloads
+type received struct {
+	number int
+	data   []byte                     // nil once the transfer is completed
+	wnd    *service.GetWindowResponse // the completed transfer if data is nil
+	err    error
+}
+
+func download(ctx context.Context, id service.TransferID, outputPath string, opts DownloadOptions, c *Client) (string, error) {
+	infoReq := service.GetTransferInfoRequest{TransferID: id, Token: c.token}
+	info := &service.GetTransferInfoResponse{}
+	if err := c.Call("Service.GetTransferInfo", infoReq, info); err != nil {
+		return "", fmt.Errorf("cannot get transfer info (%v): %w", id, err)
+	}
+
+	limits, err := getServerLimits(c)
+	if err != nil {
+		return "", err
+	}
+
+	wnd, err := getWindow(c, id)
+	if err != nil {
+		return "", err
+	}
+
+	outputPath = outputName(id, info.Metadata, outputPath)
+	log.Printf("receiving %s (%d bytes, %s) to %s", info.Metadata.Name, info.Metadata.Size, info.Metadata.ContentType, outputPath)
+
+	// acked chunks are dropped by the server, they can only be taken from the file written before
+	if (wnd.Base > 0 || len(wnd.Acked) > 0) && !opts.Resume {
+		return "", fmt.Errorf("%d batches of %v were already received, resume the download into the file they were written to",
+			wnd.Base+len(wnd.Acked), id)
+	}
+
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if opts.Resume {
+		flags = os.O_RDWR | os.O_CREATE
+	}
 
-		err = c.Call("Service.UploadChunk", uploadReq, uploadResp)
+	f, err := os.OpenFile(outputPath, flags, 0666)
+	if err != nil {
+		return "", fmt.Errorf("cannot create file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	out := io.MultiWriter(f, hash)
+
+	// chunks acked out of order are no longer on the server, they are read back from the file
+	acked := make(map[int]bool)
+	if opts.Resume {
+		stored, err := skipReceived(f, hash, wnd.Base, info.Metadata)
 		if err != nil {
-			return fmt.Errorf("cannot upload chunk %d (%v): %w", batchNumber, initResp.TransferID, err)
+			return "", err
 		}
 
-		batchNumber++
+		for _, number := range wnd.Acked {
+			if number >= stored {
+				return "", fmt.Errorf("cannot resume download: batch %d was received before, but it is not in %s", number, outputPath)
+			}
+
+			acked[number] = true
+		}
+
+		log.Printf("resuming download of %v from batch %d", id, wnd.Base)
+	}
+
+	// keep up to the window size of chunks in flight, the sender can not get further ahead anyway
+	size := wnd.Size
+	if size == 0 {
+		size = defaultInFlight
+	}
+
+	// fetches and acks still running are dropped once the download returns
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan received, size)
+	failed := make(chan error, 1)
+	var acks sync.WaitGroup
+
+	fail := func(err error) error {
+		if ctx.Err() == nil {
+			return err
+		}
+
+		return abort(c, id, "receiver interrupted", ctx.Err())
+	}
+
+	fetch := func(number int) {
+		go func() {
+			resp, wnd, err := receiveChunk(callCtx, c, id, number, limits.MaxWait)
+			r := received{number: number, wnd: wnd, err: err}
+			if resp != nil {
+				r.data, r.err = chunkData(resp)
+			}
+
+			results <- r
+		}()
+	}
+
+	// the ack does not hold up the following chunks, the window moves once the server gets it
+	ack := func(number int) {
+		acks.Add(1)
+		go func() {
+			defer acks.Done()
+
+			req := service.ConfirmChunkDownloadedRequest{TransferID: id, ChunkNumber: number, Token: c.token}
+			if err := call(callCtx, c.Client, "Service.ConfirmChunkDownloaded", req, &service.ConfirmChunkDownloadedResponse{}); err != nil {
+				select {
+				case failed <- fmt.Errorf("cannot confirm chunk %d (%v): %w", number, id, err):
+				default:
+				}
+			}
+		}()
+	}
+
+	// chunks are fetched in any order, but written and acked in order, so the file is hashed as it is written
+	var completed *service.GetWindowResponse
+	fetched := make(map[int][]byte)
+	next, written, inFlight := wnd.Base, wnd.Base, 0
+	flush := func() error {
+		for data, ok := fetched[written]; ok; data, ok = fetched[written] {
+			if _, err := out.Write(data); err != nil {
+				return fmt.Errorf("cannot write file: %w", err)
+			}
+
+			delete(fetched, written)
+			if !acked[written] {
+				ack(written)
+				log.Printf("received batch %d of transfer %v", written, id)
+			}
+
+			written++
+		}
+
+		return nil
+	}
+
+	for {
+		// one chunk past the declared end is fetched to learn that the transfer is completed
+		for completed == nil && next < written+size && (info.NumOfChunks == 0 || next <= info.NumOfChunks) {
+			if acked[next] {
+				data, err := readChunk(f, next, info.Metadata)
+				if err != nil {
+					return "", err
+				}
+
+				fetched[next] = data
+			} else {
+				fetch(next)
+				inFlight++
+			}
+
+			next++
+		}
+
+		if err := flush(); err != nil {
+			return "", err
+		}
+
+		if inFlight == 0 {
+			if completed != nil {
+				break
+			}
+
+			continue
+		}
+
+		var r received
+		select {
+		case r = <-results:
+		case err := <-failed:
+			return "", fail(err)
+		}
+
+		inFlight--
+		if r.err != nil {
+			return "", fail(fmt.Errorf("cannot download chunk %d (%v): %w", r.number, id, r.err))
+		}
+
+		if r.data == nil {
+			completed = r.wnd
+			continue
+		}
+
+		fetched[r.number] = r.data
+	}
+
+	acks.Wait()
+	if written != completed.NumOfChunks {
+		return "", fmt.Errorf("transfer %v was completed after %d of %d batches, the rest was received by another download",
+			id, written, completed.NumOfChunks)
+	}
+
+	if digest := hash.Sum(nil); !bytes.Equal(digest, completed.Digest) {
+		return "", fmt.Errorf("%w: file %s has digest %x, expected %x", service.ErrChecksumMismatch, outputPath, digest, completed.Digest)
+	}
+
+	log.Printf("received all %d batches of %v, digest %x", written, id, completed.Digest)
+
+	if info.Metadata.Mode != 0 {
+		if err := f.Chmod(info.Metadata.Mode.Perm()); err != nil {
+			return "", fmt.Errorf("cannot restore permissions of %s: %w", outputPath, err)
+		}
+	}
+
+	if !info.Metadata.ModTime.IsZero() {
+		if err := os.Chtimes(outputPath, time.Now(), info.Metadata.ModTime); err != nil {
+			return "", fmt.Errorf("cannot restore modification time of %s: %w", outputPath, err)
+		}
+	}
+
+	return outputPath, nil
+}
+
+// skipReceived hashes the chunks below base written by the interrupted download and moves to the end of them.
+// It returns how many whole chunks the file has, anything after them is dropped.
+func skipReceived(f *os.File, hash io.Writer, base int, metadata service.Metadata) (int, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read file info: %w", err)
+	}
+
+	if info.Size() == 0 {
+		if base > 0 {
+			return 0, fmt.Errorf("cannot resume download: %d batches were received before, but %s is empty", base, f.Name())
+		}
+
+		return 0, nil
+	}
+
+	if metadata.ChunkSize <= 0 {
+		return 0, fmt.Errorf("cannot resume download: chunk size is not known")
+	}
+
+	stored := int(info.Size() / int64(metadata.ChunkSize))
+	if info.Size() >= metadata.Size {
+		stored = int((metadata.Size + int64(metadata.ChunkSize) - 1) / int64(metadata.ChunkSize))
+	}
+
+	if stored < base {
+		return 0, fmt.Errorf("cannot resume download: %d batches were received before, %s has %d", base, f.Name(), stored)
+	}
+
+	if err := f.Truncate(chunkOffset(stored, metadata)); err != nil {
+		return 0, fmt.Errorf("cannot truncate file: %w", err)
+	}
+
+	if _, err := io.CopyN(hash, f, chunkOffset(base, metadata)); err != nil {
+		return 0, fmt.Errorf("cannot read file: %w", err)
+	}
+
+	return stored, nil
+}
+
+// readChunk reads the chunk written by the interrupted download
+func readChunk(f *os.File, number int, metadata service.Metadata) ([]byte, error) {
+	offset := chunkOffset(number, metadata)
+	data := make([]byte, chunkOffset(number+1, metadata)-offset)
+	if _, err := f.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("cannot read batch %d from %s: %w", number, f.Name(), err)
+	}
+
+	return data, nil
+}
+
+// chunkOffset returns where the chunk starts in the file
+func chunkOffset(number int, metadata service.Metadata) int64 {
+	offset := int64(number) * int64(metadata.ChunkSize)
+	if offset > metadata.Size {
+		return metadata.Size
+	}
+
+	return offset
+}
+
+// chunkData decodes the chunk and checks it against the digest declared by the sender.
+// Servers without raw payload support ignore the request and send base64 data.
+func chunkData(resp *service.DownloadChunkResponse) ([]byte, error) {
+	data := resp.Payload
+	if data == nil {
+		var err error
+		data, err = base64.StdEncoding.DecodeString(resp.Data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode chunk %d: %w", resp.ChunkNumber, err)
+		}
+	}
+
+	if !bytes.Equal(service.Digest(data), resp.Digest) {
+		return nil, fmt.Errorf("%w: chunk %d is corrupted", service.ErrChecksumMismatch, resp.ChunkNumber)
+	}
+
+	return data, nil
+}
+
+// outputName picks the path to save the file: the original name is used if the path is empty or a directory
+func outputName(id service.TransferID, metadata service.Metadata, outputPath string) string {
+	name := filepath.Base(metadata.Name)
+	if metadata.Name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		name = id.String()
+	}
+
+	if outputPath == "" {
+		return name
+	}
+
+	if stat, err := os.Stat(outputPath); err == nil && stat.IsDir() {
+		return filepath.Join(outputPath, name)
+	}
+
+	return outputPath
+}
+
+func getWindow(c *Client, id service.TransferID) (*service.GetWindowResponse, error) {
+	req := service.GetWindowRequest{TransferID: id, Token: c.token}
+	resp := &service.GetWindowResponse{}
+	if err := c.Call("Service.GetWindow", req, resp); err != nil {
+		return nil, fmt.Errorf("cannot get window (%v): %w", id, err)
+	}
+
+	return resp, nil
+}
+
+// describe collects the file metadata for the receiver and rewinds the file
+func describe(f *os.File, info os.FileInfo, chunkSize int) (service.Metadata, error) {
+	contentType := mime.TypeByExtension(filepath.Ext(info.Name()))
+	if contentType == "" {
+		head := make([]byte, 512)
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return service.Metadata{}, fmt.Errorf("cannot read file: %w", err)
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return service.Metadata{}, fmt.Errorf("cannot rewind file: %w", err)
+		}
+
+		contentType = http.DetectContentType(head[:n])
+	}
+
+	return service.Metadata{
+		Name:        info.Name(),
+		Size:        info.Size(),
+		ChunkSize:   chunkSize,
+		Mode:        info.Mode().Perm(),
+		ModTime:     info.ModTime(),
+		ContentType: contentType,
+	}, nil
+}
+
+// fileDigest returns SHA-256 of the file and rewinds it
+func fileDigest(f *os.File) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, fmt.Errorf("cannot read file: %w", err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("cannot rewind file: %w", err)
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// receiveChunk waits for the chunk, blocking on the server up to maxWait at a time.
+// Servers without blocking calls (maxWait is 0) and calls which returned early are repeated after pollInterval.
+// The window is returned instead of the chunk once the transfer is completed.
+func receiveChunk(ctx context.Context, c *Client, id service.TransferID, number int, maxWait time.Duration) (*service.DownloadChunkResponse, *service.GetWindowResponse, error) {
+	for {
+		started := time.Now()
+		req := service.DownloadChunkRequest{
+			TransferID:  id,
+			ChunkNumber: number,
+			Raw:         true,
+			Timeout:     maxWait,
+			Token:       c.token,
+		}
+
+		resp := &service.DownloadChunkResponse{}
+		err := call(ctx, c.Client, "Service.DownloadChunk", req, resp)
+		if err == nil {
+			return resp, nil, nil
+		}
+
+		// servers without blocking calls do not accept downloads before the first chunk
+		if !service.Is(err, service.ErrChunkNotAvailable) && !(maxWait == 0 && service.Is(err, service.ErrInvalidState)) {
+			return nil, nil, err
+		}
+
+		wnd, err := getWindow(c, id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch wnd.State {
+		case service.StateCompleted:
+			return nil, wnd, nil
+		case service.StateCancelled:
+			return nil, nil, fmt.Errorf("%w: %s", service.ErrCancelled, wnd.Reason)
+		case service.StateFailed:
+			return nil, nil, fmt.Errorf("transfer %v is %s: %s", id, wnd.State, wnd.Reason)
+		}
+
+		// the chunk was acknowledged by another download or the server does not block, so it is not asked for again at once
+		if maxWait > 0 && time.Since(started) >= maxWait {
+			continue
+		}
+
+		if err := sleep(ctx, pollInterval); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// call is rpc.Client.Call which returns once ctx is done, the reply is dropped then
+func call(ctx context.Context, c *rpc.Client, method string, args interface{}, reply interface{}) error {
+	select {
+	case done := <-c.Go(method, args, reply, make(chan *rpc.Call, 1)).Done:
+		return done.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func getServerLimits(c *Client) (*service.GetServerLimitsResponse, error) {
+	resp := &service.GetServerLimitsResponse{}
+	if err := c.Call("Service.GetServerLimits", service.GetServerLimitsRequest{}, resp); err != nil {
+		return nil, fmt.Errorf("cannot get server limits: %w", err)
+	}
+
+	return resp, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func cancelTransfer(c *Client, id service.TransferID, reason string) error {
+	req := service.CancelTransferRequest{TransferID: id, Reason: reason, Token: c.token}
+	if err := c.Call("Service.CancelTransfer", req, &service.CancelTransferResponse{}); err != nil {
+		return fmt.Errorf("cannot cancel transfer %v: %w", id, err)
 	}
 
 	return nil
 }
 
-func download(id service.TransferID) (string, error) {
-	return "", nil
+// abort cancels the transfer after the context is done and returns the cause
+func abort(c *Client, id service.TransferID, reason string, cause error) error {
+	if err := cancelTransfer(c, id, reason); err != nil {
+		log.Print(err)
+	} else {
+		log.Printf("transfer %v cancelled", id)
+	}
+
+	return fmt.Errorf("transfer %v interrupted: %w", id, cause)
 }
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eqr/transferit/app/links"
+	"github.com/eqr/transferit/app/service"
+)
+
+// LinkOptions restrict who can use the share link
+type LinkOptions struct {
+	TTL          time.Duration // links.DefaultTTL if 0
+	MaxDownloads int           // 1 for a single download, 0 if not limited
+	IPs          []string      // addresses or CIDR ranges allowed to download, any if empty
+}
+
+// CreateLink returns the URL anyone can download the transfer with, no account is needed
+func (c *Client) CreateLink(id service.TransferID, opts LinkOptions) (string, time.Time, error) {
+	req := links.CreateRequest{Token: c.token, TransferID: id, TTL: opts.TTL, MaxDownloads: opts.MaxDownloads, IPs: opts.IPs}
+	resp := &links.CreateResponse{}
+	if err := c.Call("Links.Create", req, resp); err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot create share link for %v: %w", id, err)
+	}
+
+	return resp.URL, resp.ExpiresAt, nil
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultProfile is used if no profile is chosen
+const DefaultProfile = "default"
+
+// Profile is the relay the client talks to and the token to use there
+type Profile struct {
+	Server  string `yaml:"server"`
+	TLS     bool   `yaml:"tls,omitempty"`
+	CA      string `yaml:"ca,omitempty"`
+	Cert    string `yaml:"cert,omitempty"`
+	Key     string `yaml:"key,omitempty"`
+	Login   string `yaml:"login,omitempty"`
+	Token   string `yaml:"token,omitempty"`
+	TokenID string `yaml:"tokenId,omitempty"` // API token created by login, revoked once it is replaced
+}
+
+// Profiles are stored in the user config dir, the file has tokens so only the user can read it
+type Profiles struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+
+	path string
+}
+
+func profilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find user config dir: %w", err)
+	}
+
+	return filepath.Join(dir, "transferit", "profiles.yml"), nil
+}
+
+// LoadProfiles reads the profiles file, it is not an error if the file does not exist yet
+func LoadProfiles() (*Profiles, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := &Profiles{Profiles: make(map[string]Profile), path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read profiles: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, profiles); err != nil {
+		return nil, fmt.Errorf("cannot parse profiles %s: %w", path, err)
+	}
+
+	if profiles.Profiles == nil {
+		profiles.Profiles = make(map[string]Profile)
+	}
+
+	return profiles, nil
+}
+
+// Get returns the profile, ok is false if it does not exist
+func (p *Profiles) Get(name string) (Profile, bool) {
+	profile, ok := p.Profiles[name]
+	return profile, ok
+}
+
+func (p *Profiles) Set(name string, profile Profile) {
+	p.Profiles[name] = profile
+}
+
+func (p *Profiles) Save() error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("error encoding profiles: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return fmt.Errorf("cannot create profiles dir: %w", err)
+	}
+
+	if err := os.WriteFile(p.path, data, 0600); err != nil {
+		return fmt.Errorf("cannot save profiles: %w", err)
+	}
+
+	return nil
+}
+
+// Path is where the profiles are stored
+func (p *Profiles) Path() string {
+	return p.path
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eqr/transferit/app/service"
+	"github.com/eqr/transferit/app/tokens"
+)
+
+// CreateToken issues the API token for the logged in user and returns its secret
+func (c *Client) CreateToken(name string, scopes []service.Scope, ttl time.Duration) (string, tokens.Token, error) {
+	req := tokens.CreateRequest{Token: c.token, Name: name, Scopes: scopes, TTL: ttl}
+	resp := &tokens.CreateResponse{}
+	if err := c.Call("Tokens.Create", req, resp); err != nil {
+		return "", tokens.Token{}, fmt.Errorf("cannot create token %s: %w", name, err)
+	}
+
+	return resp.Secret, resp.Info, nil
+}
+
+func (c *Client) ListTokens() ([]tokens.Token, error) {
+	req := tokens.ListRequest{Token: c.token}
+	resp := &tokens.ListResponse{}
+	if err := c.Call("Tokens.List", req, resp); err != nil {
+		return nil, fmt.Errorf("cannot list tokens: %w", err)
+	}
+
+	return resp.Tokens, nil
+}
+
+func (c *Client) RevokeToken(id string) error {
+	req := tokens.RevokeRequest{Token: c.token, ID: id}
+	if err := c.Call("Tokens.Revoke", req, &tokens.RevokeResponse{}); err != nil {
+		return fmt.Errorf("cannot revoke token %s: %w", id, err)
+	}
+
+	return nil
+}
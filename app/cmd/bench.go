@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/eqr/transferit/app/bench"
+	"github.com/spf13/cobra"
+)
+
+// command to measure the transfer service throughput
+var BenchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "measures throughput of concurrent transfers",
+	Long: `runs concurrent transfers through the transfer service in this process,
+every transfer has a sender and a receiver, the network is not involved`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := bench.Options{
+			Transfers:       BenchTransfers,
+			Chunks:          BenchChunks,
+			ChunkSize:       BenchChunkSize,
+			WindowSize:      BenchWindowSize,
+			StoreAndForward: BenchStore,
+		}
+
+		if err := runBench(opts); err != nil {
+			log.Fatal(err.Error())
+		}
+	},
+}
+
+func runBench(opts bench.Options) error {
+	dir, err := os.MkdirTemp("", "transferit-bench")
+	if err != nil {
+		return fmt.Errorf("cannot create bench dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := bench.New(dir, opts)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	began := time.Now()
+	if err := b.Run(); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(began)
+	total := float64(opts.Transfers) * float64(opts.Chunks)
+	log.Printf("%d transfers of %d chunks of %d bytes, window %d, store and forward %v",
+		opts.Transfers, opts.Chunks, opts.ChunkSize, opts.WindowSize, opts.StoreAndForward)
+	log.Printf("%v, %.0f chunks/s, %.1f MB/s", elapsed.Round(time.Millisecond),
+		total/elapsed.Seconds(), total*float64(opts.ChunkSize)/elapsed.Seconds()/1024/1024)
+	return nil
+}
+
+var BenchTransfers int
+var BenchChunks int
+var BenchChunkSize int
+var BenchWindowSize int
+var BenchStore bool
+
+func BuildBench() {
+	BenchCmd.Flags().IntVarP(&BenchTransfers, "transfers", "t", 200, "number of concurrent transfers")
+	BenchCmd.Flags().IntVarP(&BenchChunks, "chunks", "n", 50, "chunks per transfer")
+	BenchCmd.Flags().IntVar(&BenchChunkSize, "chunk-size", 64*1024, "chunk size in bytes")
+	BenchCmd.Flags().IntVarP(&BenchWindowSize, "window", "w", 4, "chunks in flight per transfer")
+	BenchCmd.Flags().BoolVarP(&BenchStore, "store", "s", false, "keep chunks in the work dir like store and forward transfers")
+}
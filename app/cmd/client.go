@@ -1,9 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
 
 	"github.com/eqr/transferit/app/client"
+	"github.com/eqr/transferit/app/links"
+	"github.com/eqr/transferit/app/service"
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +23,14 @@ var TransferCmd = &cobra.Command{
 	Use:   "file",
 	Short: "uploads and downloads",
 	Long:  `file management`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// cobra runs only the closest hook
+		RootCmd.PersistentPreRun(cmd, args)
+
+		if err := applyProfile(cmd); err != nil {
+			log.Fatal(err.Error())
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 	},
 }
@@ -28,18 +48,384 @@ var UploadCmd = &cobra.Command{
 
 		fileName := args[0]
 
-		cl, err := client.Connect("localhost:8083")
+		opts := client.UploadOptions{StoreAndForward: StoreAndForward, Recipients: Recipients}
+		if ShareLink {
+			opts.Link = &client.LinkOptions{TTL: LinkTTL, MaxDownloads: LinkDownloads, IPs: LinkIPs}
+		}
+
+		if ResumeID != "" {
+			id, err := uuid.Parse(ResumeID)
+			if err != nil {
+				log.Fatalf("incorrect transfer id %s: %v", ResumeID, err.Error())
+			}
+
+			opts.Resume = id
+		}
+
+		cl, err := connect()
 		if err != nil {
 			log.Fatalf("cannot connect: %v", err.Error())
 		}
 
-		err = cl.Upload(fileName)
+		ctx, stop := interruptible()
+		defer stop()
+
+		err = cl.Upload(ctx, fileName, opts)
 		if err != nil {
 			log.Fatalf("error uploading file %s: %v", fileName, err.Error())
 		}
 	},
 }
 
+// command to share the transfer
+var LinkCmd = &cobra.Command{
+	Use:   "link <transfer-id>",
+	Short: "prints a share link",
+	Long:  `prints the link anyone can download the transfer with in the browser, no account is needed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			log.Fatal("no transfer id provided")
+		}
+
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			log.Fatalf("incorrect transfer id %s: %v", args[0], err.Error())
+		}
+
+		cl, err := connect()
+		if err != nil {
+			log.Fatalf("cannot connect: %v", err.Error())
+		}
+
+		url, expiresAt, err := cl.CreateLink(id, client.LinkOptions{TTL: LinkTTL, MaxDownloads: LinkDownloads, IPs: LinkIPs})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Printf("valid until %s", expiresAt.Format(time.RFC3339))
+		fmt.Println(url)
+	},
+}
+
+// command to download file
+var DownloadCmd = &cobra.Command{
+	Use:   "download <transfer-id>",
+	Short: "downloads a file",
+	Long:  `downloads a file uploaded by another client`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) == 0 {
+			log.Fatal("no transfer id provided")
+		}
+
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			log.Fatalf("incorrect transfer id %s: %v", args[0], err.Error())
+		}
+
+		cl, err := connect()
+		if err != nil {
+			log.Fatalf("cannot connect: %v", err.Error())
+		}
+
+		ctx, stop := interruptible()
+		defer stop()
+
+		fileName, err := cl.Download(ctx, id, OutputPath, client.DownloadOptions{Resume: ResumeDownload})
+		if err != nil {
+			log.Fatalf("error downloading transfer %v: %v", id, err.Error())
+		}
+
+		log.Printf("downloaded %v to %s", id, fileName)
+	},
+}
+
+// command to cancel a transfer
+var CancelCmd = &cobra.Command{
+	Use:   "cancel <transfer-id>",
+	Short: "cancels a transfer",
+	Long:  `cancels a transfer for both the sender and the receiver`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) == 0 {
+			log.Fatal("no transfer id provided")
+		}
+
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			log.Fatalf("incorrect transfer id %s: %v", args[0], err.Error())
+		}
+
+		cl, err := connect()
+		if err != nil {
+			log.Fatalf("cannot connect: %v", err.Error())
+		}
+
+		if err := cl.Cancel(id, CancelReason); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Printf("cancelled %v", id)
+	},
+}
+
+// command to get a token for the other commands
+var LoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "logs in to the server",
+	Long: `checks the login and the password of the server user, creates an API token and saves it
+with the server address to the profile, the password is asked for if it is not set`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if LoginName == "" {
+			log.Fatal("login is required")
+		}
+
+		password := LoginPassword
+		if password == "" {
+			var err error
+			password, err = readPassword(fmt.Sprintf("password of %s: ", LoginName))
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+		}
+
+		cl, err := connect()
+		if err != nil {
+			log.Fatalf("cannot connect: %v", err.Error())
+		}
+
+		if _, err := cl.Login(LoginName, password); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		// the login token expires in two days, the API token lasts as long as --expires,
+		// it manages tokens only if asked to
+		scopes := []service.Scope{service.ScopeUpload, service.ScopeDownload}
+		if LoginAdmin {
+			scopes = append(scopes, service.ScopeAdmin)
+		}
+
+		hostname, _ := os.Hostname()
+		name := fmt.Sprintf("login of profile %s on %s", ProfileName, hostname)
+		secret, token, err := cl.CreateToken(name, scopes, LoginTTL)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		profiles, err := client.LoadProfiles()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		previous, replaced := profiles.Get(ProfileName)
+		profile := client.Profile{
+			Server:  ServerAddress,
+			TLS:     UseTLS,
+			CA:      absPath(CAFile),
+			Cert:    absPath(CertFile),
+			Key:     absPath(KeyFile),
+			Login:   LoginName,
+			Token:   secret,
+			TokenID: token.ID,
+		}
+
+		profiles.Set(ProfileName, profile)
+		if err := profiles.Save(); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Printf("logged in to %s as %s, saved token %s to profile %s in %s", ServerAddress, LoginName, token.ID, ProfileName, profiles.Path())
+
+		// revoked with the login token, the new one may not have the admin scope
+		if replaced && previous.TokenID != "" && previous.Server == ServerAddress && previous.Login == LoginName {
+			if err := cl.RevokeToken(previous.TokenID); err != nil {
+				log.Printf("cannot revoke the token replaced in profile %s: %v", ProfileName, err)
+			}
+		}
+	},
+}
+
+// command to list profiles
+var ProfilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "lists profiles",
+	Long:  `lists servers saved by login, pick one with --profile`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profiles, err := client.LoadProfiles()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		if len(profiles.Profiles) == 0 {
+			fmt.Println("no profiles exist, run file login")
+			return
+		}
+
+		names := make([]string, 0, len(profiles.Profiles))
+		for name := range profiles.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			profile := profiles.Profiles[name]
+			marker := " "
+			if name == ProfileName {
+				marker = "*"
+			}
+
+			fmt.Printf("%s %s\t%s\t%s\n", marker, name, profile.Server, profile.Login)
+		}
+	},
+}
+
+// tokenEnv is used if --token is not set
+const tokenEnv = "TRANSFERIT_TOKEN"
+
+// defaultLoginTTL is the lifetime of the token saved by login if --expires is not set
+const defaultLoginTTL = 90 * 24 * time.Hour
+
+// applyProfile fills connection settings which were not set by flags from the profile
+func applyProfile(cmd *cobra.Command) error {
+	profiles, err := client.LoadProfiles()
+	if err != nil {
+		return err
+	}
+
+	profile, ok := profiles.Get(ProfileName)
+	if !ok {
+		if cmd.Flags().Changed("profile") && cmd != LoginCmd {
+			return fmt.Errorf("profile %s does not exist, run file login", ProfileName)
+		}
+
+		return nil
+	}
+
+	flags := cmd.Flags()
+	if !flags.Changed("server") && profile.Server != "" {
+		ServerAddress = profile.Server
+	}
+
+	if !flags.Changed("tls") {
+		UseTLS = UseTLS || profile.TLS
+	}
+
+	if !flags.Changed("ca") {
+		CAFile = profile.CA
+	}
+
+	if !flags.Changed("cert") {
+		CertFile = profile.Cert
+	}
+
+	if !flags.Changed("key") {
+		KeyFile = profile.Key
+	}
+
+	if Token == "" && os.Getenv(tokenEnv) == "" {
+		Token = profile.Token
+	}
+
+	return nil
+}
+
+// absPath keeps certificates usable from any dir, empty path stays empty
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	return abs
+}
+
+// connect dials the server set by the flags, TLS is used if any of the certificates is set
+func connect() (*client.Client, error) {
+	var tlsConfig *tls.Config
+	if UseTLS || CAFile != "" || CertFile != "" || KeyFile != "" {
+		var err error
+		tlsConfig, err = client.TLSConfig(CAFile, CertFile, KeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cl, err := client.Connect(ServerAddress, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	token := Token
+	if token == "" {
+		token = os.Getenv(tokenEnv)
+	}
+
+	cl.SetToken(token)
+	return cl, nil
+}
+
+// interruptible returns the context which is done on Ctrl-C or SIGTERM,
+// so the transfer is cancelled on the server instead of being left behind
+func interruptible() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+var ProfileName string
+var ServerAddress string
+var UseTLS bool
+var CAFile string
+var CertFile string
+var KeyFile string
+var Token string
+var LoginName string
+var LoginPassword string
+var LoginTTL time.Duration
+var LoginAdmin bool
+var Recipients []string
+var OutputPath string
+var CancelReason string
+var StoreAndForward bool
+var ResumeID string
+var ResumeDownload bool
+var ShareLink bool
+var LinkTTL time.Duration
+var LinkDownloads int
+var LinkIPs []string
+
 func BuildFileManager() {
+	TransferCmd.PersistentFlags().StringVar(&ProfileName, "profile", client.DefaultProfile, "profile saved by login to take the server and the token from")
+	TransferCmd.PersistentFlags().StringVar(&ServerAddress, "server", "localhost:8083", "address of the transfer endpoint")
+	TransferCmd.PersistentFlags().BoolVar(&UseTLS, "tls", false, "connect with TLS, implied by --ca, --cert and --key")
+	TransferCmd.PersistentFlags().StringVar(&CAFile, "ca", "", "CA file to verify the server, system roots are used if empty")
+	TransferCmd.PersistentFlags().StringVar(&CertFile, "cert", "", "client certificate for servers which require one")
+	TransferCmd.PersistentFlags().StringVar(&KeyFile, "key", "", "private key of the client certificate")
+	TransferCmd.PersistentFlags().StringVar(&Token, "token", "", "API token, "+tokenEnv+" or the profile token is used if empty")
+	LoginCmd.Flags().StringVarP(&LoginName, "login", "l", "", "login of the server user")
+	LoginCmd.Flags().StringVarP(&LoginPassword, "password", "p", "", "password of the server user, it is asked for if empty")
+	LoginCmd.Flags().DurationVar(&LoginTTL, "expires", defaultLoginTTL, "lifetime of the token saved to the profile, it does not expire if 0")
+	LoginCmd.Flags().BoolVar(&LoginAdmin, "admin", false, "let the token saved to the profile manage tokens")
+	UploadCmd.Flags().StringSliceVar(&Recipients, "to", nil, "logins of the users allowed to download, any user if empty")
+	UploadCmd.Flags().BoolVarP(&StoreAndForward, "store", "s", false, "keep the file on the server until it is downloaded")
+	UploadCmd.Flags().StringVarP(&ResumeID, "resume", "r", "", "id of the interrupted transfer to continue")
+	UploadCmd.Flags().BoolVar(&ShareLink, "link", false, "print the link anyone can download the file with in the browser")
+	UploadCmd.Flags().DurationVar(&LinkTTL, "link-expires", links.DefaultTTL, "how long the share link is valid")
+	UploadCmd.Flags().IntVar(&LinkDownloads, "link-downloads", 0, "1 to let the share link start a single download, not limited if 0")
+	UploadCmd.Flags().StringSliceVar(&LinkIPs, "link-ip", nil, "addresses or CIDR ranges allowed to use the share link, any if empty")
+	LinkCmd.Flags().DurationVar(&LinkTTL, "expires", links.DefaultTTL, "how long the link is valid")
+	LinkCmd.Flags().IntVar(&LinkDownloads, "downloads", 0, "1 to let the link start a single download, not limited if 0")
+	LinkCmd.Flags().StringSliceVar(&LinkIPs, "ip", nil, "addresses or CIDR ranges allowed to use the link, any if empty")
+	DownloadCmd.Flags().StringVarP(&OutputPath, "output", "o", "", "file or directory to save the download to, the original file name is used by default")
+	DownloadCmd.Flags().BoolVarP(&ResumeDownload, "resume", "r", false, "continue the interrupted download into the existing output file")
+	CancelCmd.Flags().StringVar(&CancelReason, "reason", "cancelled by user", "reason reported to the other side")
+
 	TransferCmd.AddCommand(UploadCmd)
+	TransferCmd.AddCommand(DownloadCmd)
+	TransferCmd.AddCommand(CancelCmd)
+	TransferCmd.AddCommand(LinkCmd)
+	TransferCmd.AddCommand(LoginCmd)
+	TransferCmd.AddCommand(ProfilesCmd)
 }
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readPassword asks for the password on the terminal without echo, piped input is read as is
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	restore, err := noEcho(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", fmt.Errorf("cannot turn off echo: %w", err)
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	restore()
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil && line == "" {
+		return "", fmt.Errorf("cannot read password: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
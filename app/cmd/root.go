@@ -50,7 +50,10 @@ var ConfigPath string
 func Build() {
 	authCmd.BuildUserManager()
 	BuildFileManager()
+	BuildTokenManager()
+	BuildBench()
 	RootCmd.PersistentFlags().StringVarP(&ConfigPath, "config", "c", "./config.yml", "path to the configuration file")
 	RootCmd.AddCommand(authCmd.UserManagerCmd)
 	RootCmd.AddCommand(TransferCmd)
+	RootCmd.AddCommand(BenchCmd)
 }
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package cmd
+
+import (
+	"fmt"
+)
+
+func noEcho(fd int) (func(), error) {
+	return nil, fmt.Errorf("the password can not be hidden on this system, set it with --password")
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package cmd
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// noEcho turns off echo of the terminal until restore is called, it does nothing if fd is not a terminal
+func noEcho(fd int) (func(), error) {
+	state, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return func() {}, nil
+	}
+
+	quiet := *state
+	quiet.Lflag &^= unix.ECHO
+	quiet.Lflag |= unix.ICANON | unix.ISIG
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &quiet); err != nil {
+		return nil, err
+	}
+
+	return func() { _ = unix.IoctlSetTermios(fd, ioctlWriteTermios, state) }, nil
+}
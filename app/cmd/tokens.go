@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/eqr/transferit/app/service"
+	"github.com/spf13/cobra"
+)
+
+// command to list API tokens
+var TokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "lists API tokens",
+	Long:  `lists API tokens of the user, managing tokens needs a login token or an API token with the admin scope`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cl, err := connect()
+		if err != nil {
+			log.Fatalf("cannot connect: %v", err.Error())
+		}
+
+		list, err := cl.ListTokens()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		if len(list) == 0 {
+			fmt.Println("no tokens exist")
+			return
+		}
+
+		for _, token := range list {
+			expires := "never"
+			if !token.ExpiresAt.IsZero() {
+				expires = token.ExpiresAt.Format(time.RFC3339)
+			}
+
+			if token.Expired(time.Now()) {
+				expires += " (expired)"
+			}
+
+			fmt.Printf("%s\t%s\t%v\texpires: %s\n", token.ID, token.Name, token.Scopes, expires)
+		}
+	},
+}
+
+// command to create an API token
+var CreateTokenCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "creates an API token",
+	Long:  `creates an API token and prints it, the token can not be shown again`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			log.Fatal("no token name provided")
+		}
+
+		scopes := make([]service.Scope, 0, len(TokenScopes))
+		for _, scope := range TokenScopes {
+			scopes = append(scopes, service.Scope(strings.TrimSpace(scope)))
+		}
+
+		cl, err := connect()
+		if err != nil {
+			log.Fatalf("cannot connect: %v", err.Error())
+		}
+
+		secret, token, err := cl.CreateToken(args[0], scopes, TokenTTL)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Printf("created token %s (%s)", token.Name, token.ID)
+		fmt.Println(secret)
+	},
+}
+
+// command to revoke an API token
+var RevokeTokenCmd = &cobra.Command{
+	Use:   "revoke <token-id>",
+	Short: "revokes an API token",
+	Long:  `revokes an API token, it can not be used anymore`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			log.Fatal("no token id provided")
+		}
+
+		cl, err := connect()
+		if err != nil {
+			log.Fatalf("cannot connect: %v", err.Error())
+		}
+
+		if err := cl.RevokeToken(args[0]); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Printf("revoked token %s", args[0])
+	},
+}
+
+var TokenScopes []string
+var TokenTTL time.Duration
+
+func BuildTokenManager() {
+	CreateTokenCmd.Flags().StringSliceVar(&TokenScopes, "scope", []string{string(service.ScopeUpload), string(service.ScopeDownload)}, "upload, download or admin")
+	CreateTokenCmd.Flags().DurationVar(&TokenTTL, "expires", 0, "lifetime of the token like 720h, it does not expire if 0")
+
+	TokensCmd.AddCommand(CreateTokenCmd)
+	TokensCmd.AddCommand(RevokeTokenCmd)
+	TransferCmd.AddCommand(TokensCmd)
+}
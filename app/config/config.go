@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -16,16 +17,35 @@ type Config struct {
 		Host         string `yaml:"host"`
 		Port         int    `yaml:"port"`
 		InternalPort int    `yaml:"internalPort"`
+		// proxies allowed to set X-Forwarded-For, share links check the address it gives; none if empty
+		TrustedProxies []string `yaml:"trustedProxies"`
 	}
 	WorkDir struct {
 		Path string `yaml:"path"`
 	}
+	Transfer struct {
+		Host     string `yaml:"host"` // address the transfer endpoint listens on
+		Port     int    `yaml:"port"`
+		JSONPort int    `yaml:"jsonPort"` // JSON-RPC endpoint for clients without gob, disabled if not set
+		TLS      struct {
+			Cert     string `yaml:"cert"`     // certificate file, TLS is disabled if empty
+			Key      string `yaml:"key"`      // private key of the certificate
+			ClientCA string `yaml:"clientCA"` // CA file to verify client certificates, they are not required if empty
+		} `yaml:"tls"`
+		WindowSize      int           `yaml:"windowSize"`      // number of chunks in flight per transfer
+		MaxChunkSize    int           `yaml:"maxChunkSize"`    // max size of the chunk in bytes before encoding
+		StoreAndForward bool          `yaml:"storeAndForward"` // allow senders to leave chunks in the work dir
+		Retention       time.Duration `yaml:"retention"`       // how long stored chunks are kept, like 72h
+		IdleTTL         time.Duration `yaml:"idleTTL"`         // transfers without progress expire after it
+		Lifetime        time.Duration `yaml:"lifetime"`        // transfers in memory expire after it
+		History         time.Duration `yaml:"history"`         // how long finished transfers are remembered
+	}
 	Templates struct {
 		Path string `yaml:"path"`
 	}
 	Deploy struct {
 		Host string `yaml:"host"`
-		Url  string `yaml:"url"`
+		Url  string `yaml:"url"` // base of share links, https unless the host is local
 	}
 	JWT struct {
 		Secret string `yaml:"secret"`
@@ -0,0 +1,252 @@
+package links
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+// audience tells share links from login tokens signed with the same secret
+const audience = "transferit-share"
+
+// DefaultTTL is used if the link expiry is not set
+const DefaultTTL = 24 * time.Hour
+
+var linksBucket = []byte("links")
+
+var (
+	ErrInvalid   = errors.New("invalid share link")
+	ErrForbidden = errors.New("share link is not valid for this address")
+	ErrExhausted = errors.New("share link has no downloads left")
+)
+
+// Claims are signed into the link, anyone holding it can download one transfer on behalf of its owner
+type Claims struct {
+	Transfer     string   `json:"tid"`
+	Owner        uint64   `json:"own"`
+	MaxDownloads int      `json:"max,omitempty"` // 1 for a single download, 0 if not limited
+	IPs          []string `json:"ips,omitempty"` // addresses or CIDR ranges allowed to download, any if empty
+	jwt.StandardClaims
+}
+
+// Issuer signs share links with the JWT secret and records the downloads started with them in the db
+type Issuer struct {
+	secret  []byte
+	baseURL string
+	db      *bolt.DB
+}
+
+func NewIssuer(secret string, baseURL string, db *bolt.DB) (*Issuer, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("share links can not be signed without the jwt secret")
+	}
+
+	if err := checkBaseURL(baseURL); err != nil {
+		return nil, err
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(linksBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot validate links bucket: %w", err)
+	}
+
+	return &Issuer{secret: []byte(secret), baseURL: strings.TrimSuffix(baseURL, "/"), db: db}, nil
+}
+
+// checkBaseURL requires https, links carry the download rights and plain http is allowed only locally
+func checkBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("incorrect deploy url %q for share links", baseURL)
+	}
+
+	if u.Scheme == "https" {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); u.Scheme == "http" && (host == "localhost" || ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+
+	return fmt.Errorf("share links need an https deploy url, got %q", baseURL)
+}
+
+// Issue signs the link to the transfer, ttl 0 means DefaultTTL
+func (i *Issuer) Issue(transfer uuid.UUID, owner uint64, ttl time.Duration, maxDownloads int, ips []string) (string, time.Time, error) {
+	if maxDownloads < 0 {
+		return "", time.Time{}, fmt.Errorf("incorrect number of downloads: %d", maxDownloads)
+	}
+
+	// received chunks are deleted, so a transfer cannot be downloaded twice
+	if maxDownloads > 1 {
+		return "", time.Time{}, fmt.Errorf("a transfer can be downloaded only once, got %d downloads", maxDownloads)
+	}
+
+	for _, ip := range ips {
+		if _, err := parseIP(ip); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := Claims{
+		Transfer:     transfer.String(),
+		Owner:        owner,
+		MaxDownloads: maxDownloads,
+		IPs:          ips,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  audience,
+			ExpiresAt: expiresAt.Unix(),
+			Id:        uuid.New().String(),
+			IssuedAt:  now.Unix(),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot sign share link: %w", err)
+	}
+
+	return i.baseURL + "/s/" + token, expiresAt, nil
+}
+
+// Parse checks the signature and the expiry of the link token
+func (i *Issuer) Parse(token string) (*Claims, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+
+		return i.secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	if !parsed.Valid || !claims.VerifyAudience(audience, true) || claims.ExpiresAt == 0 {
+		return nil, ErrInvalid
+	}
+
+	return claims, nil
+}
+
+// Allow returns ErrForbidden if the address is not allowed to use the link
+func (c *Claims) Allow(addr string) error {
+	if len(c.IPs) == 0 {
+		return nil
+	}
+
+	ip := net.ParseIP(addr)
+	for _, allowed := range c.IPs {
+		network, err := parseIP(allowed)
+		if err == nil && ip != nil && network.Contains(ip) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrForbidden, addr)
+}
+
+// parseIP accepts an address or a CIDR range
+func parseIP(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("incorrect address %q", value)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect address range %q: %w", value, err)
+	}
+
+	return network, nil
+}
+
+// Claim starts the download and returns its id which the following calls of the download present,
+// it returns ErrExhausted if another download has started. The check and the record are done
+// in one transaction, so concurrent downloads cannot both pass. Links without a limit need no id.
+func (i *Issuer) Claim(c *Claims) (string, error) {
+	if c.MaxDownloads == 0 {
+		return "", nil
+	}
+
+	download := uuid.New().String()
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+		if bucket.Get([]byte(c.Id)) != nil {
+			return fmt.Errorf("%w: %d of %d used", ErrExhausted, c.MaxDownloads, c.MaxDownloads)
+		}
+
+		return bucket.Put([]byte(c.Id), []byte(download))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return download, nil
+}
+
+// Verify returns ErrExhausted if the link is limited and the download is not the one which claimed it
+func (i *Issuer) Verify(c *Claims, download string) error {
+	if c.MaxDownloads == 0 {
+		return nil
+	}
+
+	var claimed bool
+	err := i.db.View(func(tx *bolt.Tx) error {
+		claimed = download != "" && string(tx.Bucket(linksBucket).Get([]byte(c.Id))) == download
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot read downloads of the link: %w", err)
+	}
+
+	if !claimed {
+		return fmt.Errorf("%w: it is used by another download", ErrExhausted)
+	}
+
+	return nil
+}
+
+// Release gives back the download claimed for a chunk which was not served
+func (i *Issuer) Release(c *Claims, download string) error {
+	if c.MaxDownloads == 0 {
+		return nil
+	}
+
+	return i.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+		if string(bucket.Get([]byte(c.Id))) != download {
+			return nil
+		}
+
+		return bucket.Delete([]byte(c.Id))
+	})
+}
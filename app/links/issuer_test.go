@@ -0,0 +1,289 @@
+package links
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+func newIssuer(t *testing.T) *Issuer {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "links.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	issuer, err := NewIssuer("secret", "https://transferit.example.com/", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return issuer
+}
+
+// issue returns the claims of a new link
+func issue(t *testing.T, issuer *Issuer, maxDownloads int, ips ...string) *Claims {
+	t.Helper()
+	link, _, err := issuer.Issue(uuid.New(), 1, time.Hour, maxDownloads, ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := issuer.Parse(strings.TrimPrefix(link, "https://transferit.example.com/s/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return claims
+}
+
+func TestCheckBaseURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://transferit.example.com", true},
+		{"http://localhost:8081", true},
+		{"http://127.0.0.1:8081", true},
+		{"http://[::1]:8081", true},
+		{"http://transferit.example.com", false},
+		{"ftp://localhost", false},
+		{"transferit.example.com", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if err := checkBaseURL(test.url); (err == nil) != test.ok {
+			t.Errorf("base url %q: got error %v, expected ok %v", test.url, err, test.ok)
+		}
+	}
+}
+
+func TestIssue(t *testing.T) {
+	issuer := newIssuer(t)
+	transfer := uuid.New()
+
+	link, expiresAt, err := issuer.Issue(transfer, 7, 0, 1, []string{"203.0.113.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(link, "https://transferit.example.com/s/") {
+		t.Errorf("unexpected link %s", link)
+	}
+
+	if d := time.Until(expiresAt); d < DefaultTTL-time.Minute || d > DefaultTTL {
+		t.Errorf("link expires in %v, expected %v", d, DefaultTTL)
+	}
+
+	claims, err := issuer.Parse(strings.TrimPrefix(link, "https://transferit.example.com/s/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Transfer != transfer.String() || claims.Owner != 7 || claims.MaxDownloads != 1 || len(claims.IPs) != 1 {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	for _, maxDownloads := range []int{-1, 2} {
+		if _, _, err := issuer.Issue(transfer, 7, 0, maxDownloads, nil); err == nil {
+			t.Errorf("link with %d downloads was issued", maxDownloads)
+		}
+	}
+
+	if _, _, err := issuer.Issue(transfer, 7, 0, 0, []string{"not an address"}); err == nil {
+		t.Error("link with an incorrect address was issued")
+	}
+}
+
+func TestParse(t *testing.T) {
+	issuer := newIssuer(t)
+	sign := func(secret string, claims Claims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	valid := jwt.StandardClaims{Audience: audience, ExpiresAt: time.Now().Add(time.Hour).Unix(), Id: "link"}
+	expired := valid
+	expired.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+	login := valid
+	login.Audience = ""
+	endless := valid
+	endless.ExpiresAt = 0
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", sign("secret", Claims{Transfer: "t", StandardClaims: valid}), true},
+		{"other secret", sign("other", Claims{Transfer: "t", StandardClaims: valid}), false},
+		{"expired", sign("secret", Claims{Transfer: "t", StandardClaims: expired}), false},
+		{"login token", sign("secret", Claims{Transfer: "t", StandardClaims: login}), false},
+		{"no expiry", sign("secret", Claims{Transfer: "t", StandardClaims: endless}), false},
+		{"garbage", "not.a.token", false},
+	}
+
+	for _, test := range tests {
+		_, err := issuer.Parse(test.token)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v, expected ok %v", test.name, err, test.ok)
+		}
+
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, ErrInvalid)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		ips  []string
+		addr string
+		ok   bool
+	}{
+		{nil, "198.51.100.1", true},
+		{[]string{"198.51.100.1"}, "198.51.100.1", true},
+		{[]string{"198.51.100.1"}, "198.51.100.2", false},
+		{[]string{"203.0.113.0/24"}, "203.0.113.77", true},
+		{[]string{"203.0.113.0/24"}, "203.0.114.1", false},
+		{[]string{"2001:db8::/32"}, "2001:db8::1", true},
+		{[]string{"2001:db8::/32", "198.51.100.1"}, "198.51.100.1", true},
+		{[]string{"198.51.100.1"}, "not an address", false},
+	}
+
+	for _, test := range tests {
+		err := (&Claims{IPs: test.ips}).Allow(test.addr)
+		if (err == nil) != test.ok {
+			t.Errorf("%v allowing %s: got error %v, expected ok %v", test.ips, test.addr, err, test.ok)
+		}
+
+		if err != nil && !errors.Is(err, ErrForbidden) {
+			t.Errorf("%v allowing %s: got error %v, expected %v", test.ips, test.addr, err, ErrForbidden)
+		}
+	}
+}
+
+func TestClaim(t *testing.T) {
+	issuer := newIssuer(t)
+	claims := issue(t, issuer, 1)
+
+	download, err := issuer.Claim(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := issuer.Verify(claims, download); err != nil {
+		t.Errorf("the download which claimed the link is refused: %v", err)
+	}
+
+	if _, err := issuer.Claim(claims); !errors.Is(err, ErrExhausted) {
+		t.Errorf("second claim: got error %v, expected %v", err, ErrExhausted)
+	}
+
+	for _, other := range []string{"", uuid.New().String()} {
+		if err := issuer.Verify(claims, other); !errors.Is(err, ErrExhausted) {
+			t.Errorf("download %q: got error %v, expected %v", other, err, ErrExhausted)
+		}
+	}
+
+	// other links are not affected
+	if _, err := issuer.Claim(issue(t, issuer, 1)); err != nil {
+		t.Errorf("claim of another link: %v", err)
+	}
+}
+
+func TestClaimNotLimited(t *testing.T) {
+	issuer := newIssuer(t)
+	claims := issue(t, issuer, 0)
+
+	for i := 0; i < 3; i++ {
+		download, err := issuer.Claim(claims)
+		if err != nil || download != "" {
+			t.Errorf("claim %d: got %q, %v, expected no id", i, download, err)
+		}
+	}
+
+	if err := issuer.Verify(claims, ""); err != nil {
+		t.Errorf("download without id is refused: %v", err)
+	}
+}
+
+func TestClaimConcurrent(t *testing.T) {
+	issuer := newIssuer(t)
+	claims := issue(t, issuer, 1)
+
+	const downloads = 20
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	claimed := 0
+	for i := 0; i < downloads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := issuer.Claim(claims)
+			if err != nil && !errors.Is(err, ErrExhausted) {
+				t.Error(err)
+			}
+
+			if err == nil {
+				lock.Lock()
+				claimed++
+				lock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	if claimed != 1 {
+		t.Errorf("%d of %d concurrent downloads claimed the link, expected 1", claimed, downloads)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	issuer := newIssuer(t)
+	claims := issue(t, issuer, 1)
+
+	download, err := issuer.Claim(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the download which claimed the link gives it back
+	if err := issuer.Release(claims, uuid.New().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := issuer.Claim(claims); !errors.Is(err, ErrExhausted) {
+		t.Errorf("claim after release by another download: got error %v, expected %v", err, ErrExhausted)
+	}
+
+	if err := issuer.Release(claims, download); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := issuer.Verify(claims, download); !errors.Is(err, ErrExhausted) {
+		t.Errorf("released download: got error %v, expected %v", err, ErrExhausted)
+	}
+
+	again, err := issuer.Claim(claims)
+	if err != nil {
+		t.Fatalf("claim after release: %v", err)
+	}
+
+	if again == download {
+		t.Error("the released id was issued again")
+	}
+}
@@ -0,0 +1,60 @@
+package links
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eqr/transferit/app/service"
+)
+
+// Service issues share links over rpc, only the sender can share the transfer
+type Service struct {
+	issuer    *Issuer
+	transfers *service.Service
+	auth      service.Authenticator
+}
+
+func NewService(issuer *Issuer, transfers *service.Service, auth service.Authenticator) *Service {
+	return &Service{issuer: issuer, transfers: transfers, auth: auth}
+}
+
+type CreateRequest struct {
+	Token        string // of the sender
+	TransferID   service.TransferID
+	TTL          time.Duration // DefaultTTL if 0
+	MaxDownloads int           // 1 for a single download, 0 if not limited
+	IPs          []string      // addresses or CIDR ranges allowed to download, any if empty
+}
+
+type CreateResponse struct {
+	URL       string
+	ExpiresAt time.Time
+}
+
+func (s *Service) Create(request *CreateRequest, response *CreateResponse) error {
+	user, err := s.auth.Authenticate(request.Token)
+	if err != nil {
+		return fmt.Errorf("%w: %v", service.ErrUnauthenticated, err)
+	}
+
+	if err := user.Need(service.ScopeUpload); err != nil {
+		return err
+	}
+
+	var info service.GetTransferInfoResponse
+	err = s.transfers.GetTransferInfo(&service.GetTransferInfoRequest{TransferID: request.TransferID, Token: request.Token}, &info)
+	if err != nil {
+		return err
+	}
+
+	if info.Owner != user.ID {
+		return fmt.Errorf("%w: only the sender can share the transfer", service.ErrPermissionDenied)
+	}
+
+	if info.State.Finished() {
+		return fmt.Errorf("%w: the transfer is %s", service.ErrInvalidState, info.State)
+	}
+
+	response.URL, response.ExpiresAt, err = s.issuer.Issue(request.TransferID, user.ID, request.TTL, request.MaxDownloads, request.IPs)
+	return err
+}
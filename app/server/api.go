@@ -0,0 +1,427 @@
+package server
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eqr/eqr-auth/auth"
+	"github.com/eqr/transferit/app/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// apiPrefix is the version of the REST API, incompatible changes go to the next version
+const apiPrefix = "/api/v1"
+
+// digestHeader carries the hex SHA-256 of the chunk body both ways
+const digestHeader = "X-Chunk-Digest"
+
+// csrfHeader has to be set by browsers authenticated with the cookie,
+// forms of other sites can send the cookie but can not set headers
+const csrfHeader = "X-Requested-With"
+
+const tokenKey = "apiToken"
+
+// transferAPI exposes the transfer service as JSON for clients without net/rpc and gob
+type transferAPI struct {
+	transfers    *service.Service
+	maxChunkSize int
+}
+
+func setupAPI(router *gin.Engine, transfers *service.Service) (*transferAPI, error) {
+	var limits service.GetServerLimitsResponse
+	if err := transfers.GetServerLimits(&service.GetServerLimitsRequest{}, &limits); err != nil {
+		return nil, fmt.Errorf("cannot get server limits: %w", err)
+	}
+
+	api := &transferAPI{transfers: transfers, maxChunkSize: limits.MaxChunkSize}
+
+	group := router.Group(apiPrefix, apiToken)
+	group.GET("/limits", api.limits)
+	group.POST("/transfers", api.create)
+	group.GET("/transfers/:id", api.status)
+	group.PUT("/transfers/:id/chunks/:chunk", api.upload)
+	group.GET("/transfers/:id/chunks/:chunk", api.download)
+	group.POST("/transfers/:id/chunks/:chunk/ack", api.ack)
+	group.POST("/transfers/:id/complete", api.complete)
+	group.POST("/transfers/:id/cancel", api.cancel)
+	group.GET("/transfers/:id/events", api.events)
+	return api, nil
+}
+
+// apiToken takes the token from the bearer header or the web login cookie,
+// the service checks it like the tokens of rpc calls
+func apiToken(c *gin.Context) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization must be a bearer token"})
+			return
+		}
+
+		c.Set(tokenKey, token)
+		return
+	}
+
+	token, err := c.Cookie(auth.AuthCookie)
+	if err != nil || token == "" {
+		return
+	}
+
+	if c.Request.Method != http.MethodGet && c.GetHeader(csrfHeader) == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": csrfHeader + " header is required with the cookie"})
+		return
+	}
+
+	c.Set(tokenKey, token)
+}
+
+// apiError responds with the status matching the service error
+func apiError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, service.ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrChunkNotAvailable):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrExpired):
+		status = http.StatusGone
+	case errors.Is(err, service.ErrInvalidState), errors.Is(err, service.ErrCancelled):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrWindowFull):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, service.ErrChecksumMismatch):
+		status = http.StatusUnprocessableEntity
+	}
+
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+func transferID(c *gin.Context) (service.TransferID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, fmt.Errorf("cannot parse transfer id %s: %w", c.Param("id"), err))
+		return service.TransferID{}, false
+	}
+
+	return id, true
+}
+
+func chunkNumber(c *gin.Context) (int, bool) {
+	n, err := strconv.Atoi(c.Param("chunk"))
+	if err != nil {
+		apiError(c, fmt.Errorf("incorrect chunk number %s", c.Param("chunk")))
+		return 0, false
+	}
+
+	return n, true
+}
+
+// timeout is the time blocking calls wait, like 10s, 0 if not set
+func timeout(c *gin.Context) (time.Duration, bool) {
+	value := c.Query("timeout")
+	if value == "" {
+		return 0, true
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		apiError(c, fmt.Errorf("incorrect timeout %s: %w", value, err))
+		return 0, false
+	}
+
+	return d, true
+}
+
+type apiLimits struct {
+	MaxChunkSize    int    `json:"maxChunkSize"`
+	WindowSize      int    `json:"windowSize"`
+	StoreAndForward bool   `json:"storeAndForward"`
+	Retention       string `json:"retention"`
+	MaxWait         string `json:"maxWait"`
+}
+
+func (a *transferAPI) limits(c *gin.Context) {
+	var limits service.GetServerLimitsResponse
+	if err := a.transfers.GetServerLimits(&service.GetServerLimitsRequest{}, &limits); err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiLimits{
+		MaxChunkSize:    limits.MaxChunkSize,
+		WindowSize:      limits.WindowSize,
+		StoreAndForward: limits.StoreAndForward,
+		Retention:       limits.Retention.String(),
+		MaxWait:         limits.MaxWait.String(),
+	})
+}
+
+type apiCreateRequest struct {
+	NumOfChunks     int              `json:"numOfChunks"` // 0 if unknown
+	StoreAndForward bool             `json:"storeAndForward"`
+	Digest          string           `json:"digest"` // hex SHA-256 of the whole file
+	Metadata        service.Metadata `json:"metadata"`
+	Recipients      []string         `json:"recipients"`
+}
+
+func (a *transferAPI) create(c *gin.Context) {
+	var request apiCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apiError(c, fmt.Errorf("cannot parse request: %w", err))
+		return
+	}
+
+	digest, err := hex.DecodeString(request.Digest)
+	if err != nil {
+		apiError(c, fmt.Errorf("incorrect file digest %s: %w", request.Digest, err))
+		return
+	}
+
+	var response service.InitUploadResponse
+	err = a.transfers.InitUpload(&service.InitUploadRequest{
+		NumOfChunks:     request.NumOfChunks,
+		StoreAndForward: request.StoreAndForward,
+		Digest:          digest,
+		Metadata:        request.Metadata,
+		Recipients:      request.Recipients,
+		Token:           c.GetString(tokenKey),
+	}, &response)
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": response.TransferID.String()})
+}
+
+type apiStatus struct {
+	ID              string           `json:"id"`
+	State           service.State    `json:"state"`
+	Reason          string           `json:"reason,omitempty"`
+	Metadata        service.Metadata `json:"metadata"`
+	NumOfChunks     int              `json:"numOfChunks"` // 0 until the sender declared the number of chunks
+	Digest          string           `json:"digest"`
+	StoreAndForward bool             `json:"storeAndForward"`
+	ExpiresAt       *time.Time       `json:"expiresAt,omitempty"`
+	Base            int              `json:"base"`       // every chunk below was acknowledged
+	WindowSize      int              `json:"windowSize"` // 0 if not limited
+	Available       []int            `json:"available"`  // chunks waiting to be downloaded
+}
+
+func (a *transferAPI) status(c *gin.Context) {
+	id, ok := transferID(c)
+	if !ok {
+		return
+	}
+
+	token := c.GetString(tokenKey)
+
+	var info service.GetTransferInfoResponse
+	if err := a.transfers.GetTransferInfo(&service.GetTransferInfoRequest{TransferID: id, Token: token}, &info); err != nil {
+		apiError(c, err)
+		return
+	}
+
+	var window service.GetWindowResponse
+	if err := a.transfers.GetWindow(&service.GetWindowRequest{TransferID: id, Token: token}, &window); err != nil {
+		apiError(c, err)
+		return
+	}
+
+	status := apiStatus{
+		ID:              id.String(),
+		State:           window.State,
+		Reason:          window.Reason,
+		Metadata:        info.Metadata,
+		NumOfChunks:     window.NumOfChunks,
+		Digest:          hex.EncodeToString(info.Digest),
+		StoreAndForward: info.StoreAndForward,
+		Base:            window.Base,
+		WindowSize:      window.Size,
+		Available:       window.Available,
+	}
+
+	if !info.ExpiresAt.IsZero() {
+		status.ExpiresAt = &info.ExpiresAt
+	}
+
+	if status.Available == nil {
+		status.Available = []int{}
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// upload takes the raw chunk as application/octet-stream, its digest is sent in X-Chunk-Digest
+func (a *transferAPI) upload(c *gin.Context) {
+	id, ok := transferID(c)
+	if !ok {
+		return
+	}
+
+	n, ok := chunkNumber(c)
+	if !ok {
+		return
+	}
+
+	wait, ok := timeout(c)
+	if !ok {
+		return
+	}
+
+	digest, err := hex.DecodeString(c.GetHeader(digestHeader))
+	if err != nil || len(digest) == 0 {
+		apiError(c, fmt.Errorf("%s header with hex SHA-256 of the chunk is required", digestHeader))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, int64(a.maxChunkSize)))
+	if err != nil {
+		apiError(c, fmt.Errorf("cannot read chunk %d, it must not be over %d bytes: %w", n, a.maxChunkSize, err))
+		return
+	}
+
+	err = a.transfers.UploadChunk(&service.UploadChunkRequest{
+		TransferID:  id.String(),
+		ChunkNumber: n,
+		Payload:     data,
+		Digest:      digest,
+		Timeout:     wait,
+		Token:       c.GetString(tokenKey),
+	}, &service.UploadChunkResponse{})
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// download returns the raw chunk, it has to be acknowledged once it is saved
+func (a *transferAPI) download(c *gin.Context) {
+	id, ok := transferID(c)
+	if !ok {
+		return
+	}
+
+	n, ok := chunkNumber(c)
+	if !ok {
+		return
+	}
+
+	wait, ok := timeout(c)
+	if !ok {
+		return
+	}
+
+	var response service.DownloadChunkResponse
+	err := a.transfers.DownloadChunk(&service.DownloadChunkRequest{
+		TransferID:  id,
+		ChunkNumber: n,
+		Raw:         true,
+		Timeout:     wait,
+		Token:       c.GetString(tokenKey),
+	}, &response)
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.Header(digestHeader, hex.EncodeToString(response.Digest))
+	c.Data(http.StatusOK, "application/octet-stream", response.Payload)
+}
+
+func (a *transferAPI) ack(c *gin.Context) {
+	id, ok := transferID(c)
+	if !ok {
+		return
+	}
+
+	n, ok := chunkNumber(c)
+	if !ok {
+		return
+	}
+
+	err := a.transfers.ConfirmChunkDownloaded(&service.ConfirmChunkDownloadedRequest{
+		TransferID:  id,
+		ChunkNumber: n,
+		Token:       c.GetString(tokenKey),
+	}, &service.ConfirmChunkDownloadedResponse{})
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type apiCompleteRequest struct {
+	NumOfChunks int `json:"numOfChunks"` // number of uploaded chunks
+}
+
+func (a *transferAPI) complete(c *gin.Context) {
+	id, ok := transferID(c)
+	if !ok {
+		return
+	}
+
+	var request apiCompleteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apiError(c, fmt.Errorf("cannot parse request: %w", err))
+		return
+	}
+
+	var response service.CompleteUploadResponse
+	err := a.transfers.CompleteUpload(&service.CompleteUploadRequest{
+		TransferID:  id,
+		NumOfChunks: request.NumOfChunks,
+		Token:       c.GetString(tokenKey),
+	}, &response)
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"state": response.State})
+}
+
+type apiCancelRequest struct {
+	Reason string `json:"reason"`
+}
+
+// cancel accepts an empty body if there is no reason
+func (a *transferAPI) cancel(c *gin.Context) {
+	id, ok := transferID(c)
+	if !ok {
+		return
+	}
+
+	var request apiCancelRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			apiError(c, fmt.Errorf("cannot parse request: %w", err))
+			return
+		}
+	}
+
+	err := a.transfers.CancelTransfer(&service.CancelTransferRequest{
+		TransferID: id,
+		Reason:     request.Reason,
+		Token:      c.GetString(tokenKey),
+	}, &service.CancelTransferResponse{})
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
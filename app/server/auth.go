@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eqr/eqr-auth/auth"
+	authConfig "github.com/eqr/eqr-auth/config"
+	"github.com/eqr/transferit/app/service"
+	"github.com/eqr/transferit/app/tokens"
+	"github.com/golang-jwt/jwt"
+)
+
+// jwtAuthenticator accepts the same tokens as the web login and API tokens
+type jwtAuthenticator struct {
+	jwt    auth.JWTService
+	users  auth.LoginService
+	tokens *tokens.Store
+}
+
+func newAuthenticator(authCfg *authConfig.Config, loginService auth.LoginService, tokenStore *tokens.Store) *jwtAuthenticator {
+	return &jwtAuthenticator{
+		jwt:    auth.JWTAuthService(authCfg),
+		users:  loginService,
+		tokens: tokenStore,
+	}
+}
+
+func (a *jwtAuthenticator) Authenticate(token string) (service.User, error) {
+	if strings.HasPrefix(token, tokens.Prefix) {
+		return a.authenticateAPI(token)
+	}
+
+	parsed, err := a.jwt.ValidateToken(token)
+	if err != nil {
+		return service.User{}, fmt.Errorf("invalid token: %w", err)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return service.User{}, errors.New("invalid token")
+	}
+
+	// json numbers are decoded as float64
+	id, ok := claims["userId"].(float64)
+	if !ok {
+		return service.User{}, fmt.Errorf("wrong user id in claims: %v", claims["userId"])
+	}
+
+	login, err := a.users.GetUserLogin(uint64(id))
+	if err != nil {
+		return service.User{}, fmt.Errorf("unknown user %d: %w", uint64(id), err)
+	}
+
+	return service.User{ID: uint64(id), Login: login}, nil
+}
+
+// authenticateAPI accepts the API token of the existing user
+func (a *jwtAuthenticator) authenticateAPI(token string) (service.User, error) {
+	apiToken, err := a.tokens.Authenticate(token)
+	if err != nil {
+		return service.User{}, err
+	}
+
+	login, err := a.users.GetUserLogin(apiToken.UserID)
+	if err != nil {
+		return service.User{}, fmt.Errorf("unknown user %d: %w", apiToken.UserID, err)
+	}
+
+	return service.User{ID: apiToken.UserID, Login: login, Scopes: apiToken.Scopes}, nil
+}
+
+func (a *jwtAuthenticator) Login(login string, password string) (string, error) {
+	ok, id := a.users.LoginUser(login, password)
+	if !ok {
+		return "", errors.New("wrong login or password")
+	}
+
+	return a.jwt.GenerateToken(login, id)
+}
+
+// ownerToken issues the token of the user for the calls made on their behalf, like downloads with share links.
+// It is never sent to clients.
+func (a *jwtAuthenticator) ownerToken(id uint64) (string, error) {
+	login, err := a.users.GetUserLogin(id)
+	if err != nil {
+		return "", fmt.Errorf("unknown user %d: %w", id, err)
+	}
+
+	return a.jwt.GenerateToken(login, id)
+}
+
+func (a *jwtAuthenticator) Lookup(login string) (service.User, error) {
+	users, err := a.users.ListUsers()
+	if err != nil {
+		return service.User{}, fmt.Errorf("cannot list users: %w", err)
+	}
+
+	for _, user := range users {
+		if user.Login == login {
+			return service.User{ID: user.Id, Login: user.Login}, nil
+		}
+	}
+
+	return service.User{}, fmt.Errorf("user %s does not exist", login)
+}
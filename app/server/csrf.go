@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sameOrigin refuses form posts made by other sites with the login cookie, which carries no SameSite attribute.
+// Browsers send Origin with every post, Referer is checked if Origin was left out. Pages are accepted
+// from the host of the request or, behind a proxy which rewrites it, from the host of the deploy url.
+func sameOrigin(deployURL string) gin.HandlerFunc {
+	var deployHost string
+	if u, err := url.Parse(deployURL); err == nil {
+		deployHost = u.Host
+	}
+
+	return func(c *gin.Context) {
+		source := c.GetHeader("Origin")
+		if source == "" || source == "null" {
+			source = c.GetHeader("Referer")
+		}
+
+		u, err := url.Parse(source)
+		if source != "" && err == nil && u.Host != "" && (u.Host == c.Request.Host || u.Host == deployHost) {
+			return
+		}
+
+		c.HTML(http.StatusForbidden, "error.html", gin.H{"title": "Forbidden", "message": "the form was not sent from this site"})
+		c.Abort()
+	}
+}
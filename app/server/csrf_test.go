@@ -0,0 +1,52 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSameOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.SetHTMLTemplate(template.Must(template.New("error.html").Parse("{{ .message }}")))
+	router.POST("/form", sameOrigin("https://transferit.example.com"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		origin  string
+		referer string
+		ok      bool
+	}{
+		{"same host", "http://localhost:8081", "", true},
+		{"deploy url", "https://transferit.example.com", "", true},
+		{"other site", "https://evil.example.com", "", false},
+		{"referer", "", "http://localhost:8081/tokens", true},
+		{"null origin", "null", "http://localhost:8081/transfers", true},
+		{"other referer", "", "https://evil.example.com/form", false},
+		{"other site with our referer", "https://evil.example.com", "http://localhost:8081/tokens", false},
+		{"neither", "", "", false},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, "http://localhost:8081/form", nil)
+		if test.origin != "" {
+			request.Header.Set("Origin", test.origin)
+		}
+
+		if test.referer != "" {
+			request.Header.Set("Referer", test.referer)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if ok := recorder.Code == http.StatusNoContent; ok != test.ok {
+			t.Errorf("%s: got status %d, expected ok %v", test.name, recorder.Code, test.ok)
+		}
+	}
+}
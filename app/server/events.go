@@ -0,0 +1,123 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/eqr/transferit/app/service"
+	"github.com/gin-gonic/gin"
+)
+
+// heartbeat is how often idle event streams are written to, so proxies keep them open
+// and the handler notices clients which left
+const heartbeat = 15 * time.Second
+
+// eventInterval limits how often progress events are sent, changes in between are merged
+const eventInterval = 250 * time.Millisecond
+
+// rateWindow is the period the throughput is averaged over
+const rateWindow = 10 * time.Second
+
+type apiProgress struct {
+	State       service.State `json:"state"`
+	Reason      string        `json:"reason,omitempty"`
+	Size        int64         `json:"size"`
+	NumOfChunks int           `json:"numOfChunks"`
+	BytesSent   int64         `json:"bytesSent"`
+	BytesAcked  int64         `json:"bytesAcked"`
+	Throughput  float64       `json:"throughput"`    // bytes acknowledged per second over the last seconds
+	ETA         float64       `json:"eta,omitempty"` // seconds until every byte is acknowledged, absent if unknown
+}
+
+type sample struct {
+	at    time.Time
+	bytes int64
+}
+
+// meter estimates the throughput and the ETA from the progress reports
+type meter struct {
+	samples []sample
+}
+
+func (m *meter) progress(p *service.WatchProgressResponse, now time.Time) apiProgress {
+	m.samples = append(m.samples, sample{at: now, bytes: p.BytesAcked})
+	for len(m.samples) > 2 && now.Sub(m.samples[1].at) > rateWindow {
+		m.samples = m.samples[1:]
+	}
+
+	progress := apiProgress{
+		State:       p.State,
+		Reason:      p.Reason,
+		Size:        p.Size,
+		NumOfChunks: p.NumOfChunks,
+		BytesSent:   p.BytesSent,
+		BytesAcked:  p.BytesAcked,
+	}
+
+	first := m.samples[0]
+	if elapsed := now.Sub(first.at).Seconds(); elapsed > 0 && p.BytesAcked > first.bytes {
+		progress.Throughput = float64(p.BytesAcked-first.bytes) / elapsed
+	}
+
+	if progress.Throughput > 0 && !p.State.Finished() {
+		progress.ETA = float64(p.Size-p.BytesAcked) / progress.Throughput
+	}
+
+	return progress
+}
+
+// events streams "progress" events of the transfer until it is finished or the client leaves,
+// failed calls end the stream with the "error" event
+func (a *transferAPI) events(c *gin.Context) {
+	id, ok := transferID(c)
+	if !ok {
+		return
+	}
+
+	request := service.WatchProgressRequest{TransferID: id, Token: c.GetString(tokenKey)}
+
+	// the first call does not wait, so the access is checked before the stream starts
+	var response service.WatchProgressResponse
+	if err := a.transfers.WatchProgress(&request, &response); err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	var m meter
+	c.SSEvent("progress", m.progress(&response, time.Now()))
+	if response.State.Finished() {
+		return
+	}
+
+	request.Timeout = heartbeat
+	last := time.Now()
+	c.Stream(func(w io.Writer) bool {
+		if pause := eventInterval - time.Since(last); pause > 0 {
+			time.Sleep(pause)
+		}
+
+		request.Version = response.Version
+		if err := a.transfers.WatchProgress(&request, &response); err != nil {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			return false
+		}
+
+		if c.Request.Context().Err() != nil {
+			return false
+		}
+
+		if response.Version == request.Version {
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		}
+
+		last = time.Now()
+		c.SSEvent("progress", m.progress(&response, last))
+		return !response.State.Finished()
+	})
+}
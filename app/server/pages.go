@@ -0,0 +1,211 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eqr/eqr-auth/auth"
+	"github.com/eqr/eqr-shared/web_common"
+	"github.com/eqr/transferit/app/links"
+	"github.com/eqr/transferit/app/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// setupTransferPages lets logged in users send, receive and follow files in the browser, forms are checked by csrf
+func setupTransferPages(group *gin.RouterGroup, transfers *service.Service, users auth.LoginService, linkService *links.Service, csrf gin.HandlerFunc) {
+	group.GET("/send", func(c *gin.Context) {
+		c.HTML(
+			http.StatusOK,
+			"send.html",
+			gin.H{
+				"title": "Send a file",
+				"to":    c.Query("to"),
+				"name":  c.Query("name"),
+			},
+		)
+	})
+
+	group.GET("/receive", func(c *gin.Context) {
+		c.HTML(
+			http.StatusOK,
+			"receive.html",
+			gin.H{
+				"title": "Receive a file",
+				"id":    c.Query("id"),
+			},
+		)
+	})
+
+	group.GET("/transfers", func(c *gin.Context) {
+		showTransfers(c, transfers, users)
+	})
+
+	group.POST("/transfers/:id/cancel", csrf, func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			web_common.ShowError(c, fmt.Errorf("cannot parse transfer id %s: %w", c.Param("id"), err))
+			return
+		}
+
+		err = transfers.CancelTransfer(&service.CancelTransferRequest{
+			TransferID: id,
+			Reason:     "cancelled on the transfers page",
+			Token:      webToken(c),
+		}, &service.CancelTransferResponse{})
+		if err != nil {
+			web_common.ShowError(c, err)
+			return
+		}
+
+		web_common.Redirect(c, "/transfers")
+	})
+
+	group.GET("/transfers/:id/link", func(c *gin.Context) {
+		showLink(c, "", time.Time{})
+	})
+
+	group.POST("/transfers/:id/link", csrf, func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			web_common.ShowError(c, fmt.Errorf("cannot parse transfer id %s: %w", c.Param("id"), err))
+			return
+		}
+
+		request := links.CreateRequest{TransferID: id, Token: webToken(c)}
+		if hours := c.PostForm("hours"); hours != "" {
+			n, err := strconv.Atoi(hours)
+			if err != nil || n <= 0 {
+				web_common.ShowErrorMessage(c, "incorrect number of hours: "+hours)
+				return
+			}
+
+			request.TTL = time.Duration(n) * time.Hour
+		}
+
+		if downloads := c.PostForm("downloads"); downloads != "" {
+			request.MaxDownloads, err = strconv.Atoi(downloads)
+			if err != nil {
+				web_common.ShowErrorMessage(c, "incorrect number of downloads: "+downloads)
+				return
+			}
+		}
+
+		for _, ip := range strings.Split(c.PostForm("ips"), ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				request.IPs = append(request.IPs, ip)
+			}
+		}
+
+		var response links.CreateResponse
+		if err := linkService.Create(&request, &response); err != nil {
+			web_common.ShowError(c, err)
+			return
+		}
+
+		showLink(c, response.URL, response.ExpiresAt)
+	})
+}
+
+// showLink shows the form for the share link or the new link
+func showLink(c *gin.Context, url string, expiresAt time.Time) {
+	c.HTML(
+		http.StatusOK,
+		"link.html",
+		gin.H{
+			"title":     "Share link",
+			"id":        c.Param("id"),
+			"url":       url,
+			"expiresAt": expiresAt,
+			"hours":     int(links.DefaultTTL.Hours()),
+		},
+	)
+}
+
+// webToken is the login cookie checked by auth.AuthorizeJWT, the service accepts it as the token
+func webToken(c *gin.Context) string {
+	token, _ := c.Cookie(auth.AuthCookie)
+	return token
+}
+
+// transferRow is the transfer with the names of the peers
+type transferRow struct {
+	service.TransferSummary
+	Peer       string // the receiver or the recipients of sent transfers, the sender of received ones
+	Recipients string // logins separated by commas to send the file again
+	Size       string
+}
+
+// showTransfers lists transfers the user has sent or receives
+func showTransfers(c *gin.Context, transfers *service.Service, users auth.LoginService) {
+	var response service.ListTransfersResponse
+	if err := transfers.ListTransfers(&service.ListTransfersRequest{Token: webToken(c)}, &response); err != nil {
+		web_common.ShowError(c, err)
+		return
+	}
+
+	logins := make(map[uint64]string)
+	login := func(id uint64) string {
+		if _, ok := logins[id]; !ok {
+			name, err := users.GetUserLogin(id)
+			if err != nil {
+				name = fmt.Sprintf("deleted user %d", id)
+			}
+
+			logins[id] = name
+		}
+
+		return logins[id]
+	}
+
+	rows := make([]transferRow, 0, len(response.Transfers))
+	for _, summary := range response.Transfers {
+		row := transferRow{TransferSummary: summary, Size: formatSize(summary.Metadata.Size)}
+
+		recipients := make([]string, 0, len(summary.Recipients))
+		for _, id := range summary.Recipients {
+			recipients = append(recipients, login(id))
+		}
+
+		row.Recipients = strings.Join(recipients, ",")
+		switch {
+		case !summary.Sent:
+			row.Peer = login(summary.Owner)
+		case summary.Receiver != 0:
+			row.Peer = login(summary.Receiver)
+		case len(recipients) == 0:
+			row.Peer = "anyone"
+		default:
+			row.Peer = strings.Join(recipients, ", ")
+		}
+
+		rows = append(rows, row)
+	}
+
+	c.HTML(
+		http.StatusOK,
+		"transfers.html",
+		gin.H{
+			"title":     "My transfers",
+			"transfers": rows,
+		},
+	)
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 3; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGT"[exp])
+}
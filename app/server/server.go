@@ -1,11 +1,16 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
 	"path"
 	"time"
 
@@ -15,7 +20,9 @@ import (
 	authController "github.com/eqr/eqr-auth/controller"
 	authService "github.com/eqr/eqr-auth/service"
 	"github.com/eqr/transferit/app/config"
+	"github.com/eqr/transferit/app/links"
 	"github.com/eqr/transferit/app/service"
+	"github.com/eqr/transferit/app/tokens"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,8 +31,22 @@ type Server struct {
 	router       *gin.Engine
 	url          string
 	internalPort int
+	transfers    *service.Service
+	internalRPC  *rpc.Server // user management for the admin cli
+	transferRPC  *rpc.Server
+	transferURL  string
+	jsonURL      string      // JSON-RPC address of the transfer service, empty if disabled
+	transferTLS  *tls.Config // nil if the transfer endpoints are plain tcp
 }
 
+const defaultTransferPort = 8083
+
+// janitorInterval is how often stale transfers are looked for
+const janitorInterval = time.Minute
+
+// flushInterval is how often progress of the transfers is saved to the db
+const flushInterval = time.Second
+
 func New(cfg *config.Config, authCfg *authConfig.Config) (*Server, error) {
 	log.Println("starting server")
 
@@ -35,51 +56,144 @@ func New(cfg *config.Config, authCfg *authConfig.Config) (*Server, error) {
 	}
 
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("incorrect trusted proxies: %w", err)
+	}
 
 	templatesPath := path.Join(cfg.Templates.Path, "*")
 	router.LoadHTMLGlob(templatesPath)
 
 	loginService := auth.NewLoginService(db)
+	tokenStore, err := tokens.NewStore(db)
+	if err != nil {
+		return nil, err
+	}
+
 	authorized := router.Group("/", auth.AuthorizeJWT(authCfg, loginService))
 	authorized.GET("/", showIndex)
+	csrf := sameOrigin(cfg.Deploy.Url)
+	setupTokenPages(authorized, tokenStore, csrf)
 
 	authController.LoginSetup(router, authCfg, loginService)
 	url := fmt.Sprintf("%v:%d", cfg.Server.Host, cfg.Server.Port)
 	log.Println("running server on ", url)
 
-	if err := authService.SetupRpc(loginService); err != nil {
+	internalRPC := rpc.NewServer()
+	if err := setupInternalRpc(internalRPC, loginService); err != nil {
 		return nil, fmt.Errorf("cannot set up internal service: %w", err)
 	}
 
-	transferService := service.New()
+	authenticator := newAuthenticator(authCfg, loginService, tokenStore)
+	transferService, err := service.New(cfg, db, authenticator)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create transfer service: %w", err)
+	}
+
+	issuer, err := links.NewIssuer(cfg.JWT.Secret, cfg.Deploy.Url, db)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := rpc.Register(transferService); err != nil {
+	linkService := links.NewService(issuer, transferService, authenticator)
+	setupTransferPages(authorized, transferService, loginService, linkService, csrf)
+
+	api, err := setupAPI(router, transferService)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set up api: %w", err)
+	}
+
+	setupShareLinks(router, api, issuer, authenticator)
+
+	transferTLS, err := transferTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transferHost := cfg.Transfer.Host
+	if transferHost == "" {
+		transferHost = "localhost"
+	}
+
+	transferPort := cfg.Transfer.Port
+	if transferPort == 0 {
+		transferPort = defaultTransferPort
+	}
+
+	var jsonURL string
+	if cfg.Transfer.JSONPort > 0 {
+		jsonURL = fmt.Sprintf("%v:%d", transferHost, cfg.Transfer.JSONPort)
+	}
+
+	transferRPC := rpc.NewServer()
+	if err := transferRPC.Register(transferService); err != nil {
 		return nil, fmt.Errorf("cannot set up transfer service: %w", err)
 	}
 
+	if err := transferRPC.RegisterName("Tokens", tokens.NewService(tokenStore, authenticator)); err != nil {
+		return nil, fmt.Errorf("cannot set up tokens service: %w", err)
+	}
+
+	if err := transferRPC.RegisterName("Links", linkService); err != nil {
+		return nil, fmt.Errorf("cannot set up links service: %w", err)
+	}
+
 	return &Server{
 		router:       router,
 		url:          url,
 		internalPort: cfg.Server.InternalPort,
+		transfers:    transferService,
+		internalRPC:  internalRPC,
+		transferRPC:  transferRPC,
+		transferURL:  fmt.Sprintf("%v:%d", transferHost, transferPort),
+		jsonURL:      jsonURL,
+		transferTLS:  transferTLS,
 	}, nil
 }
 
 func (srv *Server) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.transfers.RunJanitor(ctx, janitorInterval)
+	go srv.transfers.RunFlusher(ctx, flushInterval)
+
 	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", srv.internalPort))
 	if err != nil {
 		return fmt.Errorf("error running internal service: %w", err)
 	}
 
 	defer listener.Close()
-	go rpc.Accept(listener)
+	go srv.internalRPC.Accept(listener)
 
-	transferListener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", 8083))
+	transferListener, err := net.Listen("tcp", srv.transferURL)
 	if err != nil {
 		return fmt.Errorf("error running transfer service: %w", err)
 	}
 
+	if srv.transferTLS != nil {
+		transferListener = tls.NewListener(transferListener, srv.transferTLS)
+	}
+
+	log.Printf("running transfer service on %s, tls: %v", srv.transferURL, srv.transferTLS != nil)
+
 	defer transferListener.Close()
-	go rpc.Accept(transferListener)
+	go srv.transferRPC.Accept(transferListener)
+
+	if srv.jsonURL != "" {
+		jsonListener, err := net.Listen("tcp", srv.jsonURL)
+		if err != nil {
+			return fmt.Errorf("error running json-rpc transfer service: %w", err)
+		}
+
+		if srv.transferTLS != nil {
+			jsonListener = tls.NewListener(jsonListener, srv.transferTLS)
+		}
+
+		log.Printf("running json-rpc transfer service on %s", srv.jsonURL)
+
+		defer jsonListener.Close()
+		go serveJSON(srv.transferRPC, jsonListener)
+	}
 
 	err = srv.router.Run(srv.url)
 	if err != nil {
@@ -90,6 +204,80 @@ func (srv *Server) Start() error {
 	return nil
 }
 
+// serveJSON serves the same rpc methods with the JSON-RPC 1.0 codec, see the service package doc
+func serveJSON(srv *rpc.Server, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("json-rpc listener stopped: %v", err)
+			return
+		}
+
+		go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// transferTLSConfig loads certificates of the transfer endpoint, it returns nil if TLS is not configured
+func transferTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	certs := cfg.Transfer.TLS
+	if certs.Cert == "" && certs.Key == "" {
+		if certs.ClientCA != "" {
+			return nil, fmt.Errorf("client certificates can not be verified without TLS, set the transfer cert and key")
+		}
+
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certs.Cert, certs.Key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load transfer certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if certs.ClientCA != "" {
+		pem, err := os.ReadFile(certs.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", certs.ClientCA)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// setupInternalRpc registers the same handlers as authService.SetupRpc,
+// which can only use the global rpc server
+func setupInternalRpc(srv *rpc.Server, loginService auth.LoginService) error {
+	if err := srv.Register(&authService.PingHandler{}); err != nil {
+		return fmt.Errorf("cannot register Ping handler: %w", err)
+	}
+
+	if err := srv.Register(&authService.ListUsersHandler{Service: loginService}); err != nil {
+		return fmt.Errorf("cannot register ListUsers handler: %w", err)
+	}
+
+	if err := srv.Register(&authService.CreateUserHandler{Service: loginService}); err != nil {
+		return fmt.Errorf("cannot register CreateUser handler: %w", err)
+	}
+
+	if err := srv.Register(&authService.DeleteUserHandler{Service: loginService}); err != nil {
+		return fmt.Errorf("cannot register DeleteUser handler: %w", err)
+	}
+
+	return nil
+}
+
 func showIndex(c *gin.Context) {
 	c.HTML(
 		http.StatusOK,
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/eqr/transferit/app/links"
+	"github.com/gin-gonic/gin"
+)
+
+const claimsKey = "shareClaims"
+
+// downloadHeader carries the id of the download which claimed a link limited to one download
+const downloadHeader = "X-Download-ID"
+
+// setupShareLinks lets anyone holding the share link download the transfer without an account.
+// The receive page and the API it calls are served under the link, the calls are made on behalf of the link owner.
+func setupShareLinks(router *gin.Engine, api *transferAPI, issuer *links.Issuer, authenticator *jwtAuthenticator) {
+	group := router.Group("/s/:token", shareLink(issuer, authenticator))
+	group.GET("", func(c *gin.Context) {
+		claims := c.MustGet(claimsKey).(*links.Claims)
+		c.HTML(
+			http.StatusOK,
+			"receive.html",
+			gin.H{
+				"title": "Receive a file",
+				"id":    claims.Transfer,
+				"api":   "/s/" + c.Param("token"),
+			},
+		)
+	})
+
+	group.GET("/limits", api.limits)
+	group.GET("/transfers/:id", api.status)
+	group.GET("/transfers/:id/events", api.events)
+	group.POST("/transfers/:id/chunks/:chunk/ack", func(c *gin.Context) {
+		claims := c.MustGet(claimsKey).(*links.Claims)
+		if err := issuer.Verify(claims, c.GetHeader(downloadHeader)); err != nil {
+			shareError(c, err)
+			return
+		}
+
+		api.ack(c)
+	})
+
+	// every download starts with the first chunk, it claims the link and gets the id which
+	// the following calls of the download present, the claim is given back if the chunk was not served
+	group.GET("/transfers/:id/chunks/:chunk", func(c *gin.Context) {
+		claims := c.MustGet(claimsKey).(*links.Claims)
+		n, ok := chunkNumber(c)
+		if !ok {
+			return
+		}
+
+		download := c.GetHeader(downloadHeader)
+		if n != 0 || download != "" {
+			if err := issuer.Verify(claims, download); err != nil {
+				shareError(c, err)
+				return
+			}
+
+			api.download(c)
+			return
+		}
+
+		download, err := issuer.Claim(claims)
+		if err != nil {
+			shareError(c, err)
+			return
+		}
+
+		if download != "" {
+			c.Header(downloadHeader, download)
+		}
+
+		api.download(c)
+		if c.Writer.Status() != http.StatusOK {
+			if err := issuer.Release(claims, download); err != nil {
+				log.Printf("cannot release download of transfer %s: %v", claims.Transfer, err)
+			}
+		}
+	})
+}
+
+// shareLink checks the link on every call and passes the token of its owner to the service
+func shareLink(issuer *links.Issuer, authenticator *jwtAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := issuer.Parse(c.Param("token"))
+		if err != nil {
+			shareError(c, err)
+			return
+		}
+
+		if err := claims.Allow(c.ClientIP()); err != nil {
+			shareError(c, err)
+			return
+		}
+
+		if id := c.Param("id"); id != "" && id != claims.Transfer {
+			shareError(c, links.ErrForbidden)
+			return
+		}
+
+		token, err := authenticator.ownerToken(claims.Owner)
+		if err != nil {
+			shareError(c, err)
+			return
+		}
+
+		c.Set(claimsKey, claims)
+		c.Set(tokenKey, token)
+	}
+}
+
+// shareError shows the error page to people who opened the link and JSON to the page scripts
+func shareError(c *gin.Context, err error) {
+	status := http.StatusNotFound
+	switch {
+	case errors.Is(err, links.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, links.ErrExhausted):
+		status = http.StatusGone
+	}
+
+	if c.FullPath() != "/s/:token" {
+		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.HTML(status, "error.html", gin.H{"title": "Receive a file", "message": err.Error()})
+	c.Abort()
+}
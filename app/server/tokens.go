@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eqr/eqr-auth/auth"
+	"github.com/eqr/eqr-shared/web_common"
+	"github.com/eqr/transferit/app/service"
+	"github.com/eqr/transferit/app/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+// setupTokenPages lets logged in users manage their API tokens, forms are checked by csrf
+func setupTokenPages(group *gin.RouterGroup, store *tokens.Store, csrf gin.HandlerFunc) {
+	group.GET("/tokens", func(c *gin.Context) {
+		showTokens(c, store, "")
+	})
+
+	group.POST("/tokens", csrf, func(c *gin.Context) {
+		userID, err := auth.GetUserId(c)
+		if err != nil {
+			return
+		}
+
+		var scopes []service.Scope
+		for _, scope := range c.PostFormArray("scopes") {
+			scopes = append(scopes, service.Scope(scope))
+		}
+
+		var ttl time.Duration
+		if days := c.PostForm("days"); days != "" {
+			n, err := strconv.Atoi(days)
+			if err != nil || n < 0 {
+				web_common.ShowErrorMessage(c, "incorrect number of days: "+days)
+				return
+			}
+
+			ttl = time.Duration(n) * 24 * time.Hour
+		}
+
+		secret, _, err := store.Create(userID, c.PostForm("name"), scopes, ttl)
+		if err != nil {
+			web_common.ShowError(c, err)
+			return
+		}
+
+		showTokens(c, store, secret)
+	})
+
+	group.POST("/tokens/:id/revoke", csrf, func(c *gin.Context) {
+		userID, err := auth.GetUserId(c)
+		if err != nil {
+			return
+		}
+
+		if err := store.Revoke(userID, c.Param("id")); err != nil {
+			web_common.ShowError(c, err)
+			return
+		}
+
+		web_common.Redirect(c, "/tokens")
+	})
+}
+
+// showTokens lists tokens of the user, the secret of the new token is shown once
+func showTokens(c *gin.Context, store *tokens.Store, secret string) {
+	userID, err := auth.GetUserId(c)
+	if err != nil {
+		return
+	}
+
+	list, err := store.List(userID)
+	if err != nil {
+		web_common.ShowError(c, err)
+		return
+	}
+
+	c.HTML(
+		http.StatusOK,
+		"tokens.html",
+		gin.H{
+			"title":  "API tokens",
+			"tokens": list,
+			"scopes": service.Scopes,
+			"secret": secret,
+			"now":    time.Now(),
+		},
+	)
+}
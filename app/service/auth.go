@@ -0,0 +1,171 @@
+package service
+
+import (
+	"fmt"
+)
+
+// User is the authenticated caller
+type User struct {
+	ID     uint64
+	Login  string
+	Scopes []Scope // what the token allows, nil if everything
+}
+
+// Scope limits what API tokens can do
+type Scope string
+
+const (
+	ScopeUpload   Scope = "upload"   // send files
+	ScopeDownload Scope = "download" // receive files
+	ScopeAdmin    Scope = "admin"    // manage tokens
+)
+
+// Scopes are all known scopes
+var Scopes = []Scope{ScopeUpload, ScopeDownload, ScopeAdmin}
+
+// Can reports if the user is allowed to do what the scope covers
+func (u *User) Can(scope Scope) bool {
+	if u.Scopes == nil {
+		return true
+	}
+
+	for _, s := range u.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Need returns ErrPermissionDenied if the user does not have the scope
+func (u *User) Need(scope Scope) error {
+	if !u.Can(scope) {
+		return fmt.Errorf("%w: the token of %s has no %s scope", ErrPermissionDenied, u.Login, scope)
+	}
+
+	return nil
+}
+
+// Authenticator checks tokens sent with every call, users come from the server user store
+type Authenticator interface {
+	// Authenticate returns the owner of the token
+	Authenticate(token string) (User, error)
+	// Login checks the password and issues a token
+	Login(login string, password string) (string, error)
+	// Lookup finds the user by login
+	Lookup(login string) (User, error)
+}
+
+// access is what the caller is going to do with the transfer
+type access int
+
+const (
+	accessSend    access = iota // upload chunks, only the owner
+	accessReceive               // download and acknowledge chunks, the owner or a recipient
+	accessWatch                 // see the progress, either side
+	accessCancel                // stop the transfer, the owner or a recipient named by them
+)
+
+// authenticate returns nil if the service does not check users
+func (s *Service) authenticate(token string) (*User, error) {
+	if s.auth == nil {
+		return nil, nil
+	}
+
+	if token == "" {
+		return nil, fmt.Errorf("%w: no token", ErrUnauthenticated)
+	}
+
+	user, err := s.auth.Authenticate(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	return &user, nil
+}
+
+// allow returns ErrPermissionDenied if the user can not access the transfer.
+// Transfers created before authentication was enabled have no owner and are open to every user.
+func (t *transfer) allow(user *User, what access) error {
+	if user == nil {
+		return nil
+	}
+
+	owner := t.Owner == 0 || user.ID == t.Owner
+	switch {
+	case what == accessSend && owner:
+		return user.Need(ScopeUpload)
+	case (what == accessWatch || what == accessCancel) && owner && user.Can(ScopeUpload):
+		return nil
+	case what == accessCancel && (owner || t.named(user.ID)):
+		return user.Need(ScopeDownload)
+	case (what == accessReceive || what == accessWatch) && (owner || t.recipient(user.ID)):
+		return user.Need(ScopeDownload)
+	}
+
+	return fmt.Errorf("%w: %s can not access the transfer", ErrPermissionDenied, user.Login)
+}
+
+// recipient reports if the user is allowed to download the transfer
+func (t *transfer) recipient(id uint64) bool {
+	return len(t.Recipients) == 0 || t.named(id)
+}
+
+// named reports if the sender has listed the user as a recipient
+func (t *transfer) named(id uint64) bool {
+	for _, recipient := range t.Recipients {
+		if recipient == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recipients resolves logins of the users allowed to receive the transfer
+func (s *Service) recipients(logins []string) ([]uint64, error) {
+	if len(logins) == 0 {
+		return nil, nil
+	}
+
+	if s.auth == nil {
+		return nil, fmt.Errorf("recipients can not be checked, authentication is disabled")
+	}
+
+	ids := make([]uint64, 0, len(logins))
+	for _, login := range logins {
+		user, err := s.auth.Lookup(login)
+		if err != nil {
+			return nil, fmt.Errorf("unknown recipient %s: %w", login, err)
+		}
+
+		ids = append(ids, user.ID)
+	}
+
+	return ids, nil
+}
+
+type LoginRequest struct {
+	Login    string
+	Password string
+}
+
+type LoginResponse struct {
+	Token string // sent as Token of every other request
+}
+
+// Login issues the token for the user of the server
+func (s *Service) Login(request *LoginRequest, response *LoginResponse) error {
+	if s.auth == nil {
+		return fmt.Errorf("authentication is disabled")
+	}
+
+	token, err := s.auth.Login(request.Login, request.Password)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	response.Token = token
+	return nil
+}
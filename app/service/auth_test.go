@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAllow(t *testing.T) {
+	const (
+		sender    = 1
+		recipient = 2
+		other     = 3
+	)
+
+	user := func(id uint64, scopes ...Scope) *User {
+		return &User{ID: id, Login: "user", Scopes: scopes}
+	}
+
+	named := &transfer{Owner: sender, Recipients: []uint64{recipient}}
+	open := &transfer{Owner: sender}
+	legacy := &transfer{}
+
+	tests := []struct {
+		name     string
+		transfer *transfer
+		user     *User
+		what     access
+		ok       bool
+	}{
+		{"sender sends", named, user(sender), accessSend, true},
+		{"sender without upload scope sends", named, user(sender, ScopeDownload), accessSend, false},
+		{"recipient sends", named, user(recipient), accessSend, false},
+		{"recipient receives", named, user(recipient), accessReceive, true},
+		{"recipient without download scope receives", named, user(recipient, ScopeUpload), accessReceive, false},
+		{"other user receives", named, user(other), accessReceive, false},
+		{"other user receives open transfer", open, user(other), accessReceive, true},
+		{"other user watches open transfer", open, user(other), accessWatch, true},
+		{"sender with upload scope watches", named, user(sender, ScopeUpload), accessWatch, true},
+		{"sender cancels", named, user(sender), accessCancel, true},
+		{"sender with upload scope cancels", open, user(sender, ScopeUpload), accessCancel, true},
+		{"recipient cancels", named, user(recipient), accessCancel, true},
+		{"recipient without download scope cancels", named, user(recipient, ScopeUpload), accessCancel, false},
+		{"other user cancels", named, user(other), accessCancel, false},
+		{"other user cancels open transfer", open, user(other), accessCancel, false},
+		{"any user cancels transfer without owner", legacy, user(other), accessCancel, true},
+		{"users are not checked", named, nil, accessCancel, true},
+	}
+
+	for _, test := range tests {
+		err := test.transfer.allow(test.user, test.what)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v, expected ok %v", test.name, err, test.ok)
+		}
+
+		if err != nil && !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, ErrPermissionDenied)
+		}
+	}
+}
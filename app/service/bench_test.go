@@ -0,0 +1,51 @@
+package service_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eqr/transferit/app/bench"
+)
+
+const (
+	benchChunkSize = 64 * 1024
+	benchWindow    = 4
+)
+
+// benchTransfers are the numbers of concurrent transfers, the throughput should not drop as they grow
+var benchTransfers = []int{100, 250, 500}
+
+func BenchmarkTransfers(b *testing.B) {
+	benchmarkTransfers(b, false)
+}
+
+func BenchmarkStoredTransfers(b *testing.B) {
+	benchmarkTransfers(b, true)
+}
+
+// benchmarkTransfers sends b.N chunks through every one of the concurrent transfers
+func benchmarkTransfers(b *testing.B, storeAndForward bool) {
+	for _, transfers := range benchTransfers {
+		b.Run(fmt.Sprintf("%d", transfers), func(b *testing.B) {
+			opts := bench.Options{
+				Transfers:       transfers,
+				Chunks:          b.N,
+				ChunkSize:       benchChunkSize,
+				WindowSize:      benchWindow,
+				StoreAndForward: storeAndForward,
+			}
+
+			run, err := bench.New(b.TempDir(), opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer run.Close()
+
+			b.SetBytes(int64(transfers) * benchChunkSize)
+			b.ResetTimer()
+			if err := run.Run(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
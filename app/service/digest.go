@@ -0,0 +1,22 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Digest returns SHA-256 of the data, it is used for chunks and whole files
+func Digest(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// verify returns ErrChecksumMismatch if the data does not match the digest
+func verify(number int, data []byte, digest []byte) error {
+	if actual := Digest(data); !bytes.Equal(actual, digest) {
+		return fmt.Errorf("%w: chunk %d has digest %x, expected %x", ErrChecksumMismatch, number, actual, digest)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+// Package service relays files from the sender to the receiver in chunks.
+//
+// The methods of Service are served with net/rpc on the transfer port as "Service.<Method>"
+// and, if transfer.jsonPort is set, on that port with JSON-RPC 1.0, one JSON object per call over the same tcp or TLS connection:
+//
+//	{"method": "Service.Login", "params": [{"Login": "alice", "Password": "secret"}], "id": 1}
+//	{"id": 1, "result": {"Token": "eyJ..."}, "error": null}
+//
+// Params is an array with the single request object, its fields are named like in the Go types
+// except Metadata, which uses its json tags.
+// []byte fields such as Digest and Payload are base64 strings, TransferID is the uuid string,
+// time.Duration fields such as Timeout are nanoseconds.
+//
+// A failed call has null result and the error message as the error string:
+//
+//	{"id": 2, "result": null, "error": "transfer not found: 0a88a451-6eee-482c-9596-070615ad5523"}
+//
+// The message starts with the text of one of the errors below, the rest is the detail.
+// Other messages mean the request itself is not valid.
+//
+//	"authentication failed"       ErrUnauthenticated, the token is missing, unknown or expired
+//	"permission denied"           ErrPermissionDenied, the user or the token scope is not allowed to do it
+//	"transfer not found"          ErrNotFound
+//	"transfer expired"            ErrExpired
+//	"transfer cancelled by peer"  ErrCancelled, the detail is the reason given by the other side
+//	"invalid transfer state"      ErrInvalidState, the call is not allowed in the current state
+//	"window is full"              ErrWindowFull, retry after the receiver acknowledged chunks
+//	"chunk is not available"      ErrChunkNotAvailable, not uploaded in time or already acknowledged
+//	"checksum mismatch"           ErrChecksumMismatch, the chunk does not match its digest
+//	"rpc: can't find method"      the method name is wrong
+package service
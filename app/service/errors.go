@@ -0,0 +1,30 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNotFound     = errors.New("transfer not found")
+	ErrInvalidState = errors.New("invalid transfer state")
+	ErrExpired      = errors.New("transfer expired")
+	ErrCancelled    = errors.New("transfer cancelled by peer")
+
+	ErrUnauthenticated  = errors.New("authentication failed")
+	ErrPermissionDenied = errors.New("permission denied")
+
+	ErrWindowFull        = errors.New("window is full")
+	ErrChunkNotAvailable = errors.New("chunk is not available")
+	ErrChecksumMismatch  = errors.New("checksum mismatch")
+)
+
+// Is reports whether err matches target. Errors returned over rpc lose their type
+// and only keep the message, so they are compared by the message prefix.
+func Is(err, target error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, target) || strings.HasPrefix(err.Error(), target.Error())
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RunJanitor expires stale transfers and forgets old finished ones until the context is done
+func (s *Service) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.cleanup(now)
+		}
+	}
+}
+
+func (s *Service) cleanup(now time.Time) {
+	s.lock.RLock()
+	transfers := make(map[TransferID]*transfer, len(s.data))
+	for id, tr := range s.data {
+		transfers[id] = tr
+	}
+	s.lock.RUnlock()
+
+	for id, tr := range transfers {
+		if s.sweep(id, tr, now) {
+			s.lock.Lock()
+			delete(s.data, id)
+			s.lock.Unlock()
+		}
+	}
+
+	if s.disk != nil {
+		if err := s.disk.purgeExpired(now); err != nil {
+			log.Printf("cannot purge expired chunks: %v", err)
+		}
+	}
+}
+
+// sweep expires the stale transfer, it returns true if the finished transfer has to be forgotten
+func (s *Service) sweep(id TransferID, tr *transfer, now time.Time) bool {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	if tr.State.Finished() {
+		if now.Sub(tr.FinishedAt) <= s.history {
+			return false
+		}
+
+		if err := s.delete(id); err != nil {
+			log.Printf("cannot delete transfer %v: %v", id, err)
+			return false
+		}
+
+		return true
+	}
+
+	reason := s.staleReason(tr, now)
+	if reason == "" {
+		return false
+	}
+
+	if err := s.store(tr).DeleteAll(id); err != nil {
+		log.Printf("cannot release chunks of expired transfer %v: %v", id, err)
+	}
+
+	tr.Window.Pending = make(map[int]bool)
+	tr.Digests = make(map[int][]byte)
+	tr.finish(StateExpired, reason)
+	log.Printf("transfer %v expired: %s", id, reason)
+
+	if err := s.save(id, tr); err != nil {
+		log.Printf("cannot save expired transfer %v: %v", id, err)
+	}
+
+	return false
+}
+
+// staleReason returns why the transfer has to expire or an empty string
+func (s *Service) staleReason(tr *transfer, now time.Time) string {
+	if tr.StoreAndForward {
+		if tr.expired(now) {
+			return fmt.Sprintf("not downloaded within %v", s.disk.retention)
+		}
+
+		// the sender and the receiver are not expected to be online at the same time
+		return ""
+	}
+
+	if now.Sub(tr.CreatedAt) > s.lifetime {
+		return fmt.Sprintf("exceeded lifetime of %v", s.lifetime)
+	}
+
+	if now.Sub(tr.UpdatedAt) > s.idleTTL {
+		return fmt.Sprintf("idle for %v", now.Sub(tr.UpdatedAt).Round(time.Second))
+	}
+
+	return ""
+}
+
+// expiresAt returns when the unfinished transfer expires unless it makes progress, zero if it is finished
+func (s *Service) expiresAt(tr *transfer) time.Time {
+	if tr.State.Finished() {
+		return time.Time{}
+	}
+
+	if tr.StoreAndForward {
+		return tr.ExpiresAt
+	}
+
+	lifetime := tr.CreatedAt.Add(s.lifetime)
+	if idle := tr.UpdatedAt.Add(s.idleTTL); idle.Before(lifetime) {
+		return idle
+	}
+
+	return lifetime
+}
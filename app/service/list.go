@@ -0,0 +1,109 @@
+package service
+
+import (
+	"sort"
+	"time"
+)
+
+// TransferSummary describes the transfer on the list of the user
+type TransferSummary struct {
+	TransferID      TransferID
+	Metadata        Metadata
+	Sent            bool     // the user is the sender, otherwise a recipient or the receiver
+	Owner           uint64   // 0 if users are not checked
+	Recipients      []uint64 // nil if any user can download
+	Receiver        uint64   // user who receives the transfer, 0 until the first chunk is acknowledged
+	State           State
+	Reason          string // why the transfer has failed, expired or was cancelled
+	NumOfChunks     int    // 0 until the sender declared the number of chunks
+	Uploaded        int    // chunks the sender has uploaded
+	Acknowledged    int    // chunks the receiver has confirmed
+	StoreAndForward bool
+	CreatedAt       time.Time
+	FinishedAt      time.Time // zero until the transfer is finished
+	ExpiresAt       time.Time // when the unfinished transfer expires unless it makes progress
+}
+
+// Progress is the share of acknowledged chunks in percent
+func (t *TransferSummary) Progress() int {
+	if t.State == StateCompleted {
+		return 100
+	}
+
+	if t.NumOfChunks == 0 {
+		return 0
+	}
+
+	return t.Acknowledged * 100 / t.NumOfChunks
+}
+
+type ListTransfersRequest struct {
+	Token string // issued by Login
+}
+
+type ListTransfersResponse struct {
+	Transfers []TransferSummary // newest first
+}
+
+// ListTransfers returns transfers the caller has sent, was named a recipient of or has received.
+// Transfers open to any user are listed for other users once they have acknowledged a chunk.
+func (s *Service) ListTransfers(request *ListTransfersRequest, response *ListTransfersResponse) error {
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	s.lock.RLock()
+	transfers := make(map[TransferID]*transfer, len(s.data))
+	for id, tr := range s.data {
+		transfers[id] = tr
+	}
+	s.lock.RUnlock()
+
+	response.Transfers = make([]TransferSummary, 0)
+	for id, tr := range transfers {
+		if summary, ok := s.summary(id, tr, user); ok {
+			response.Transfers = append(response.Transfers, summary)
+		}
+	}
+
+	sort.Slice(response.Transfers, func(i, j int) bool {
+		return response.Transfers[i].CreatedAt.After(response.Transfers[j].CreatedAt)
+	})
+
+	return nil
+}
+
+// summary describes the transfer if the user has sent or receives it, every transfer is listed if user is nil
+func (s *Service) summary(id TransferID, tr *transfer, user *User) (TransferSummary, bool) {
+	tr.lock.RLock()
+	defer tr.lock.RUnlock()
+
+	sent := user == nil || user.ID == tr.Owner
+	if sent && user != nil && !user.Can(ScopeUpload) {
+		return TransferSummary{}, false
+	}
+
+	if !sent && (!tr.named(user.ID) && tr.Receiver != user.ID || !user.Can(ScopeDownload)) {
+		return TransferSummary{}, false
+	}
+
+	uploaded, acked := tr.chunks()
+	return TransferSummary{
+		TransferID:      id,
+		Metadata:        tr.Metadata,
+		Sent:            sent,
+		Owner:           tr.Owner,
+		Recipients:      tr.Recipients,
+		Receiver:        tr.Receiver,
+		State:           tr.State,
+		Reason:          tr.Reason,
+		NumOfChunks:     tr.NumOfChunks,
+		Uploaded:        uploaded,
+		Acknowledged:    acked,
+		StoreAndForward: tr.StoreAndForward,
+		CreatedAt:       tr.CreatedAt,
+		FinishedAt:      tr.FinishedAt,
+		ExpiresAt:       s.expiresAt(tr),
+	}, true
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// listed returns the summary of the transfer on the list of the user
+func listed(t *testing.T, srv *Service, token string, id TransferID) (TransferSummary, bool) {
+	t.Helper()
+	var response ListTransfersResponse
+	if err := srv.ListTransfers(&ListTransfersRequest{Token: token}, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, summary := range response.Transfers {
+		if summary.TransferID == id {
+			return summary, true
+		}
+	}
+
+	return TransferSummary{}, false
+}
+
+func TestListTransfers(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "list.db"))
+	defer db.Close()
+	srv := newService(t, testConfig(t, false), db)
+
+	chunk := []byte("chunk")
+	open := send(t, srv, false, nil, chunk, chunk)
+	named := send(t, srv, false, []string{"carol"}, chunk)
+
+	tests := []struct {
+		user string
+		id   TransferID
+		ok   bool
+	}{
+		{"alice", open, true},
+		{"alice", named, true},
+		{"bob", open, false},
+		{"bob", named, false},
+		{"carol", open, false},
+		{"carol", named, true},
+	}
+
+	for _, test := range tests {
+		if _, ok := listed(t, srv, test.user, test.id); ok != test.ok {
+			t.Errorf("%s: transfer %v listed %v, expected %v", test.user, test.id, ok, test.ok)
+		}
+	}
+
+	// the open transfer is listed for the user who received it
+	upload(t, srv, open, 0, chunk)
+	receive(t, srv, open, 0, "bob")
+
+	summary, ok := listed(t, srv, "bob", open)
+	if !ok || summary.Sent || summary.Receiver != 2 {
+		t.Errorf("bob: transfer %v listed %v as %+v, expected received by bob", open, ok, summary)
+	}
+
+	summary, ok = listed(t, srv, "alice", open)
+	if !ok || !summary.Sent || summary.Receiver != 2 {
+		t.Errorf("alice: transfer %v listed %v as %+v, expected sent to bob", open, ok, summary)
+	}
+
+	if _, ok := listed(t, srv, "carol", open); ok {
+		t.Errorf("carol: transfer %v received by bob is listed", open)
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metadata describes the file being transferred
+type Metadata struct {
+	Name        string      `json:"name"` // base name of the original file
+	Size        int64       `json:"size"`
+	ChunkSize   int         `json:"chunkSize"` // size of every chunk but the last one
+	Mode        os.FileMode `json:"mode"`
+	ModTime     time.Time   `json:"modTime"`
+	ContentType string      `json:"contentType"`
+}
+
+func (m Metadata) validate() error {
+	if m.Name != filepath.Base(m.Name) || m.Name == "." || m.Name == ".." {
+		return fmt.Errorf("incorrect file name %q", m.Name)
+	}
+
+	if m.Size < 0 || m.ChunkSize < 0 {
+		return fmt.Errorf("incorrect size %d or chunk size %d", m.Size, m.ChunkSize)
+	}
+
+	return nil
+}
+
+// numOfChunks returns how many chunks the file is split into, 0 if the chunk size is not known
+func (m Metadata) numOfChunks() int {
+	if m.ChunkSize <= 0 {
+		return 0
+	}
+
+	return int((m.Size + int64(m.ChunkSize) - 1) / int64(m.ChunkSize))
+}
+
+// chunkLen returns the size of the chunk, the last one may be shorter
+func (m Metadata) chunkLen(number int) int {
+	rest := m.Size - int64(number)*int64(m.ChunkSize)
+	if rest < int64(m.ChunkSize) {
+		return int(rest)
+	}
+
+	return m.ChunkSize
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/google/uuid"
+)
+
+var transfersBucket = []byte("transfers")
+
+// save writes the transfer state to the db, so it survives server restarts.
+// Every saved change counts as the transfer activity and wakes up the waiting calls.
+// It is used for changes of the state, chunks uploaded or acked within it are saved by touch.
+func (s *Service) save(id TransferID, tr *transfer) error {
+	tr.UpdatedAt = time.Now()
+	tr.notify()
+
+	data, err := encode(id, tr)
+	if err != nil {
+		return err
+	}
+
+	s.dirtyLock.Lock()
+	delete(s.dirty, id)
+	s.dirtyLock.Unlock()
+
+	version := tr.version
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		s.dirtyLock.Lock()
+		defer s.dirtyLock.Unlock()
+
+		s.saved[id] = version
+		return tx.Bucket(transfersBucket).Put([]byte(id.String()), data)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot save transfer %v: %w", id, err)
+	}
+
+	return nil
+}
+
+// touch records the uploaded or acked chunk like save, but the transfer is written to the db by the next flush,
+// so the chunks do not wait for the db commit one by one. Progress lost on a crash is recovered
+// like the chunks lost on restart: the sender uploads them again, see restore.
+func (s *Service) touch(id TransferID, tr *transfer) {
+	tr.UpdatedAt = time.Now()
+	tr.notify()
+
+	s.dirtyLock.Lock()
+	s.dirty[id] = tr
+	s.dirtyLock.Unlock()
+}
+
+// RunFlusher writes the progress recorded by touch to the db every interval until the context is done
+func (s *Service) RunFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.flush(); err != nil {
+				log.Printf("cannot save progress of transfers: %v", err)
+			}
+
+			return
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				log.Printf("cannot save progress of transfers: %v", err)
+			}
+		}
+	}
+}
+
+// flush writes every transfer touched since the last flush in one db transaction
+func (s *Service) flush() error {
+	snap, err := s.snapshot()
+	if err != nil || len(snap.data) == 0 {
+		return err
+	}
+
+	return s.write(snap)
+}
+
+// snapshot is the encoded copy of the touched transfers
+type snapshot struct {
+	transfers map[TransferID]*transfer
+	data      map[TransferID][]byte
+	versions  map[TransferID]uint64
+}
+
+// snapshot encodes the transfers touched since the last flush, they are not dirty anymore
+func (s *Service) snapshot() (*snapshot, error) {
+	s.dirtyLock.Lock()
+	dirty := s.dirty
+	s.dirty = make(map[TransferID]*transfer)
+	s.dirtyLock.Unlock()
+
+	snap := &snapshot{
+		transfers: dirty,
+		data:      make(map[TransferID][]byte, len(dirty)),
+		versions:  make(map[TransferID]uint64, len(dirty)),
+	}
+
+	for id, tr := range dirty {
+		tr.lock.RLock()
+		data, err := encode(id, tr)
+		snap.versions[id] = tr.version
+		tr.lock.RUnlock()
+		if err != nil {
+			s.markDirty(dirty)
+			return nil, err
+		}
+
+		snap.data[id] = data
+	}
+
+	return snap, nil
+}
+
+// write saves the snapshot. Write transactions run one by one, so a transfer saved
+// since the snapshot was taken is newer than its copy and is not overwritten with it.
+func (s *Service) write(snap *snapshot) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		s.dirtyLock.Lock()
+		defer s.dirtyLock.Unlock()
+
+		bucket := tx.Bucket(transfersBucket)
+		for id, data := range snap.data {
+			if s.saved[id] > snap.versions[id] {
+				continue
+			}
+
+			if err := bucket.Put([]byte(id.String()), data); err != nil {
+				return err
+			}
+
+			s.saved[id] = snap.versions[id]
+		}
+
+		return nil
+	})
+	if err != nil {
+		s.markDirty(snap.transfers)
+		return fmt.Errorf("cannot save %d transfers: %w", len(snap.data), err)
+	}
+
+	return nil
+}
+
+// markDirty lets the next flush try again, it writes the transfers as they are by then
+func (s *Service) markDirty(transfers map[TransferID]*transfer) {
+	s.dirtyLock.Lock()
+	defer s.dirtyLock.Unlock()
+
+	for id, tr := range transfers {
+		if _, ok := s.dirty[id]; !ok {
+			s.dirty[id] = tr
+		}
+	}
+}
+
+func encode(id TransferID, tr *transfer) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tr); err != nil {
+		return nil, fmt.Errorf("error encoding transfer %v: %w", id, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// load reads transfers saved before the restart
+func (s *Service) load() error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(transfersBucket)
+		if err != nil {
+			return fmt.Errorf("cannot validate transfers bucket: %w", err)
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			id, err := uuid.ParseBytes(k)
+			if err != nil {
+				return fmt.Errorf("incorrect transfer id %s: %w", k, err)
+			}
+
+			tr := &transfer{}
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(tr); err != nil {
+				return fmt.Errorf("error decoding transfer %v: %w", id, err)
+			}
+
+			s.data[id] = tr
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// the disk store reads the db, so the transfers are restored after the transaction
+	for id, tr := range s.data {
+		s.restore(id, tr)
+	}
+
+	return nil
+}
+
+// restore drops chunks which did not survive the restart, the sender has to upload them again
+func (s *Service) restore(id TransferID, tr *transfer) {
+	tr.changed = make(chan struct{})
+
+	// gob does not send empty values
+	if tr.Window == nil {
+		tr.Window = newWindow(0)
+	}
+
+	if tr.Window.Pending == nil {
+		tr.Window.Pending = make(map[int]bool)
+	}
+
+	if tr.Window.Received == nil {
+		tr.Window.Received = make(map[int]bool)
+	}
+
+	if tr.Digests == nil {
+		tr.Digests = make(map[int][]byte)
+	}
+
+	if tr.State.Finished() {
+		return
+	}
+
+	if tr.StoreAndForward && s.disk == nil {
+		log.Printf("transfer %v failed: store and forward is disabled", id)
+		tr.finish(StateFailed, "store and forward is disabled")
+		return
+	}
+
+	if tr.StoreAndForward {
+		// the disk store removes acked chunks at once, so pending chunks which are gone were acked before the crash
+		for _, number := range tr.Window.available() {
+			if !s.disk.has(id, number) {
+				if _, err := tr.Window.ack(number); err != nil {
+					log.Printf("cannot restore ack of chunk %d of %v: %v", number, id, err)
+				}
+
+				delete(tr.Digests, number)
+			}
+		}
+
+		if tr.State == StateAwaitingAck {
+			tr.finishUpload()
+		}
+
+		return
+	}
+
+	for number := range tr.Window.Pending {
+		delete(tr.Window.Pending, number)
+		delete(tr.Window.Received, number)
+		delete(tr.Digests, number)
+	}
+
+	if tr.State == StateAwaitingAck {
+		tr.State = StateUploading
+	}
+}
+
+func (s *Service) delete(id TransferID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		s.dirtyLock.Lock()
+		delete(s.saved, id)
+		s.dirtyLock.Unlock()
+
+		return tx.Bucket(transfersBucket).Delete([]byte(id.String()))
+	})
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func getWindow(t *testing.T, srv *Service, id TransferID) GetWindowResponse {
+	t.Helper()
+	var response GetWindowResponse
+	if err := srv.GetWindow(&GetWindowRequest{TransferID: id, Token: "alice"}, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+func resume(t *testing.T, srv *Service, id TransferID) ResumeUploadResponse {
+	t.Helper()
+	var response ResumeUploadResponse
+	if err := srv.ResumeUpload(&ResumeUploadRequest{TransferID: id, Token: "alice"}, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+func TestRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "restart.db")
+	cfg := testConfig(t, false)
+	chunks := [][]byte{[]byte("chunk 0"), []byte("chunk 1"), []byte("chunk 2"), []byte("chunk 3")}
+
+	db := openDB(t, path)
+	srv := newService(t, cfg, db)
+	id := send(t, srv, false, nil, chunks...)
+	for number := 0; number < 3; number++ {
+		upload(t, srv, id, number, chunks[number])
+	}
+
+	receive(t, srv, id, 0, "bob")
+	receive(t, srv, id, 2, "bob")
+	if err := srv.flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// chunks kept in memory are lost, the sender uploads chunk 1 again, the receiver has chunk 2 already
+	db = openDB(t, path)
+	defer db.Close()
+	srv = newService(t, cfg, db)
+
+	wnd := getWindow(t, srv, id)
+	if wnd.Base != 1 || !sameInts(wnd.Available, nil) || !sameInts(wnd.Acked, []int{2}) || wnd.State != StateUploading {
+		t.Errorf("window after restart: got %+v, expected base 1, nothing available, 2 acknowledged, uploading", wnd)
+	}
+
+	next := resume(t, srv, id)
+	if next.NextChunk != 1 || next.NumOfChunks != 4 || next.ChunkSize != len(chunks[0]) || next.State != StateUploading {
+		t.Errorf("resume after restart: got %+v, expected chunk 1 of 4", next)
+	}
+
+	upload(t, srv, id, 1, chunks[1])
+	upload(t, srv, id, 2, chunks[2])
+	upload(t, srv, id, 3, chunks[3])
+	for _, number := range []int{1, 3} {
+		if data := receive(t, srv, id, number, "bob"); !bytes.Equal(data, chunks[number]) {
+			t.Errorf("chunk %d after restart: got %q, expected %q", number, data, chunks[number])
+		}
+	}
+
+	if err := srv.CompleteUpload(&CompleteUploadRequest{TransferID: id, NumOfChunks: 4, Token: "alice"}, &CompleteUploadResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if wnd := getWindow(t, srv, id); wnd.State != StateCompleted || wnd.Base != 4 {
+		t.Errorf("window after the upload: got %+v, expected completed at 4", wnd)
+	}
+}
+
+func TestRestartStored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "restart.db")
+	cfg := testConfig(t, true)
+	chunks := [][]byte{[]byte("chunk 0"), []byte("chunk 1"), []byte("chunk 2")}
+
+	db := openDB(t, path)
+	srv := newService(t, cfg, db)
+	id := send(t, srv, true, nil, chunks...)
+	for number, chunk := range chunks {
+		upload(t, srv, id, number, chunk)
+	}
+
+	if err := srv.CompleteUpload(&CompleteUploadRequest{TransferID: id, NumOfChunks: 3, Token: "alice"}, &CompleteUploadResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the acks are not flushed, the chunks they deleted from the disk tell them after the restart
+	receive(t, srv, id, 0, "bob")
+	receive(t, srv, id, 2, "bob")
+	db.Close()
+
+	db = openDB(t, path)
+	defer db.Close()
+	srv = newService(t, cfg, db)
+
+	wnd := getWindow(t, srv, id)
+	if wnd.Base != 1 || !sameInts(wnd.Available, []int{1}) || !sameInts(wnd.Acked, []int{2}) || wnd.State != StateAwaitingAck {
+		t.Errorf("window after restart: got %+v, expected base 1, 1 available, 2 acknowledged, awaiting ack", wnd)
+	}
+
+	if next := resume(t, srv, id); next.NextChunk != 3 || next.State != StateAwaitingAck {
+		t.Errorf("resume after restart: got %+v, expected nothing to upload", next)
+	}
+
+	if data := receive(t, srv, id, 1, "bob"); !bytes.Equal(data, chunks[1]) {
+		t.Errorf("chunk 1 after restart: got %q, expected %q", data, chunks[1])
+	}
+
+	if wnd := getWindow(t, srv, id); wnd.State != StateCompleted {
+		t.Errorf("window after the last ack: got %+v, expected completed", wnd)
+	}
+}
+
+func TestFlushKeepsNewerSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flush.db")
+	cfg := testConfig(t, false)
+	chunks := [][]byte{[]byte("chunk 0"), []byte("chunk 1")}
+
+	db := openDB(t, path)
+	srv := newService(t, cfg, db)
+	id := send(t, srv, false, nil, chunks...)
+	upload(t, srv, id, 0, chunks[0])
+	upload(t, srv, id, 1, chunks[1])
+
+	// the flush encodes the uploading transfer, then the last ack completes it before the flush writes
+	snap, err := srv.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive(t, srv, id, 0, "bob")
+	receive(t, srv, id, 1, "bob")
+	if err := srv.CompleteUpload(&CompleteUploadRequest{TransferID: id, NumOfChunks: 2, Token: "alice"}, &CompleteUploadResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := srv.write(snap); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = openDB(t, path)
+	defer db.Close()
+	srv = newService(t, cfg, db)
+
+	if wnd := getWindow(t, srv, id); wnd.State != StateCompleted {
+		t.Errorf("state after restart: got %s, expected %s", wnd.State, StateCompleted)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"time"
+)
+
+// chunks returns how many chunks were uploaded and acknowledged
+func (t *transfer) chunks() (uploaded int, acked int) {
+	if t.State == StateCompleted {
+		return t.NumOfChunks, t.NumOfChunks
+	}
+
+	uploaded = t.Window.Base + len(t.Window.Received)
+	if t.State.Finished() {
+		// pending chunks were dropped, only the chunks below Base are known to be acknowledged
+		return uploaded, t.Window.Base
+	}
+
+	return uploaded, uploaded - len(t.Window.Pending)
+}
+
+// bytes converts the number of chunks to bytes, the last chunk may be shorter
+func (t *transfer) bytes(chunks int) int64 {
+	n := int64(chunks) * int64(t.Metadata.ChunkSize)
+	if n > t.Metadata.Size {
+		return t.Metadata.Size
+	}
+
+	return n
+}
+
+type WatchProgressRequest struct {
+	TransferID TransferID
+	Version    uint64        // the last version seen, the call returns at once if the transfer has changed since
+	Timeout    time.Duration // how long to wait for the change, see MaxWait
+	Token      string        // issued by Login
+}
+
+type WatchProgressResponse struct {
+	Version     uint64 // grows on every change of the transfer
+	State       State
+	Reason      string // why the transfer has failed, expired or was cancelled
+	Size        int64
+	NumOfChunks int   // 0 until the sender declared the number of chunks
+	BytesSent   int64 // uploaded by the sender
+	BytesAcked  int64 // confirmed by the receiver
+	UpdatedAt   time.Time
+}
+
+// WatchProgress blocks up to request.Timeout until the transfer changes after request.Version.
+// Finished transfers are reported at once.
+func (s *Service) WatchProgress(request *WatchProgressRequest, response *WatchProgressResponse) error {
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	// unlike view it reports expired transfers, so watchers see why they stopped
+	tr, err := s.lookup(request.TransferID)
+	if err != nil {
+		return err
+	}
+
+	tr.lock.RLock()
+	defer tr.lock.RUnlock()
+
+	if err := tr.allow(user, accessWatch); err != nil {
+		return err
+	}
+
+	until := deadline(request.Timeout)
+	for tr.version == request.Version && !tr.State.Finished() {
+		if !wait(tr.lock.RLocker(), tr, until) {
+			break
+		}
+	}
+
+	uploaded, acked := tr.chunks()
+	response.Version = tr.version
+	response.State = tr.State
+	response.Reason = tr.Reason
+	response.Size = tr.Metadata.Size
+	response.NumOfChunks = tr.NumOfChunks
+	response.BytesSent = tr.bytes(uploaded)
+	response.BytesAcked = tr.bytes(acked)
+	response.UpdatedAt = tr.UpdatedAt
+	return nil
+}
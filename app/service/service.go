@@ -1,64 +1,274 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/boltdb/bolt"
+	"github.com/eqr/transferit/app/config"
 	"github.com/google/uuid"
 )
 
+// TransferID must not be embedded into rpc messages: uuid.UUID implements encoding.BinaryMarshaler
+// and gob would encode the whole message as the bare id
 type TransferID = uuid.UUID
 
 type InitUploadRequest struct {
-	NumOfChunks int
+	NumOfChunks     int    // 0 if unknown, required for store and forward
+	StoreAndForward bool   // keep chunks on the server until the receiver downloads them
+	Digest          []byte // SHA-256 of the whole file, checked by the receiver
+	Metadata        Metadata
+	Recipients      []string // logins of the users allowed to download, any user if empty
+	Token           string   // issued by Login
 }
 
 type InitUploadResponse struct {
-	TransferID
+	TransferID TransferID
+}
+
+// NullCurrentSegmentID is reported when there is no chunk waiting to be downloaded
+const NullCurrentSegmentID = -1
+
+const defaultWindowSize = 4
+
+const defaultMaxChunkSize = 2 * 1024 * 1024
+
+const defaultRetention = 24 * time.Hour
+
+const (
+	defaultIdleTTL  = time.Hour
+	defaultLifetime = 24 * time.Hour
+	defaultHistory  = 7 * 24 * time.Hour
+)
+
+func durationOrDefault(d time.Duration, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+
+	return d
+}
+
+// New creates the service, every call is allowed if auth is nil
+func New(cfg *config.Config, db *bolt.DB, auth Authenticator) (*Service, error) {
+	data := make(map[TransferID]*transfer)
+	lock := &sync.RWMutex{}
+
+	windowSize := cfg.Transfer.WindowSize
+	if windowSize <= 0 {
+		windowSize = defaultWindowSize
+	}
+
+	maxChunkSize := cfg.Transfer.MaxChunkSize
+	if maxChunkSize <= 0 {
+		maxChunkSize = defaultMaxChunkSize
+	}
+
+	service := &Service{
+		data:         data,
+		lock:         lock,
+		windowSize:   windowSize,
+		maxChunkSize: maxChunkSize,
+		idleTTL:      durationOrDefault(cfg.Transfer.IdleTTL, defaultIdleTTL),
+		lifetime:     durationOrDefault(cfg.Transfer.Lifetime, defaultLifetime),
+		history:      durationOrDefault(cfg.Transfer.History, defaultHistory),
+		db:           db,
+		dirty:        make(map[TransferID]*transfer),
+		saved:        make(map[TransferID]uint64),
+		auth:         auth,
+	}
+
+	if cfg.Transfer.StoreAndForward {
+		retention := durationOrDefault(cfg.Transfer.Retention, defaultRetention)
+
+		disk, err := newDiskStore(cfg.WorkDir.Path, db, retention)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set up store and forward: %w", err)
+		}
+
+		if err := disk.purgeExpired(time.Now()); err != nil {
+			return nil, fmt.Errorf("cannot purge expired chunks: %w", err)
+		}
+
+		service.disk = disk
+	}
+
+	if err := service.load(); err != nil {
+		return nil, fmt.Errorf("cannot load transfers: %w", err)
+	}
+
+	log.Printf("loaded %d transfers", len(data))
+	return service, nil
 }
 
-type CurrentSegment struct {
-	Number     int
-	LastNumber int
-	Data       string // base64 encoded file segment
+// Service keeps every transfer behind its own lock, so slow transfers do not hold up the others
+type Service struct {
+	data         map[TransferID]*transfer
+	lock         *sync.RWMutex // guards the data map only
+	windowSize   int
+	maxChunkSize int
+	idleTTL      time.Duration
+	lifetime     time.Duration
+	history      time.Duration
+	disk         *diskStore // nil if store and forward is disabled
+	db           *bolt.DB
+	dirty        map[TransferID]*transfer // touched since the last flush
+	saved        map[TransferID]uint64    // versions of the transfers last written to the db
+	dirtyLock    sync.Mutex               // guards dirty and saved
+	auth         Authenticator            // nil if users are not checked
 }
 
-const nullCurrentSegmentID = -1
+// lookup finds the transfer, the registry is locked only for the map access
+func (s *Service) lookup(id TransferID) (*transfer, error) {
+	s.lock.RLock()
+	tr, ok := s.data[id]
+	s.lock.RUnlock()
 
-func (s *Service) setNullCurrentSegment(transferID TransferID) error {
-	segment, ok := s.data[transferID]
 	if !ok {
-		return fmt.Errorf("transfer not running: %v", transferID)
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, id)
 	}
 
-	segment.LastNumber = segment.Number
-	segment.Number = nullCurrentSegmentID
-	segment.Data = ""
+	return tr, nil
+}
 
-	s.data[transferID] = segment
-	return nil
+// get returns the transfer locked for changes, the caller has to unlock it
+func (s *Service) get(id TransferID) (*transfer, error) {
+	tr, err := s.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tr.lock.Lock()
+	if err := tr.alive(id); err != nil {
+		tr.lock.Unlock()
+		return nil, err
+	}
+
+	return tr, nil
 }
 
-func New() *Service {
-	data := make(map[TransferID]CurrentSegment)
-	lock := &sync.RWMutex{}
+// view returns the transfer locked for reading, the caller has to unlock it
+func (s *Service) view(id TransferID) (*transfer, error) {
+	tr, err := s.lookup(id)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Service{
-		data: data,
-		lock: lock,
+	tr.lock.RLock()
+	if err := tr.alive(id); err != nil {
+		tr.lock.RUnlock()
+		return nil, err
 	}
+
+	return tr, nil
 }
 
-type Service struct {
-	data map[TransferID]CurrentSegment
-	lock *sync.RWMutex
+func (s *Service) store(tr *transfer) chunkStore {
+	if tr.StoreAndForward {
+		return s.disk
+	}
+
+	return memoryStore{tr: tr}
+}
+
+type GetServerLimitsRequest struct {
+}
+
+type GetServerLimitsResponse struct {
+	MaxChunkSize    int  // max size of the chunk before encoding
+	WindowSize      int  // chunks in flight per transfer
+	RawPayload      bool // chunks can be sent as Payload
+	StoreAndForward bool
+	Retention       time.Duration // how long stored transfers are kept
+	MaxWait         time.Duration // the longest Timeout of blocking calls, 0 if they do not block
+}
+
+// GetServerLimits lets clients adjust to the server before the transfer starts
+func (s *Service) GetServerLimits(_ *GetServerLimitsRequest, response *GetServerLimitsResponse) error {
+	response.MaxChunkSize = s.maxChunkSize
+	response.WindowSize = s.windowSize
+	response.RawPayload = true
+	response.StoreAndForward = s.disk != nil
+	response.MaxWait = maxWait
+	if s.disk != nil {
+		response.Retention = s.disk.retention
+	}
+
+	return nil
 }
 
 func (s *Service) InitUpload(request *InitUploadRequest, response *InitUploadResponse) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	if request.NumOfChunks < 0 {
+		return fmt.Errorf("incorrect number of chunks: %d", request.NumOfChunks)
+	}
+
+	if request.StoreAndForward && s.disk == nil {
+		return fmt.Errorf("store and forward is disabled on the server")
+	}
+
+	if len(request.Digest) != sha256.Size {
+		return fmt.Errorf("incorrect file digest: %x", request.Digest)
+	}
+
+	if err := request.Metadata.validate(); err != nil {
+		return err
+	}
+
+	if request.Metadata.ChunkSize > s.maxChunkSize {
+		return fmt.Errorf("chunk size %d is over the limit of %d", request.Metadata.ChunkSize, s.maxChunkSize)
+	}
+
+	// stored chunks stay in the work dir until retention ends, so the upload is bounded by the declared size
+	if request.StoreAndForward && (request.Metadata.ChunkSize == 0 || request.NumOfChunks != request.Metadata.numOfChunks()) {
+		return fmt.Errorf("stored transfer of %d bytes in chunks of %d needs %d chunks declared, got %d",
+			request.Metadata.Size, request.Metadata.ChunkSize, request.Metadata.numOfChunks(), request.NumOfChunks)
+	}
+
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	if user != nil {
+		if err := user.Need(ScopeUpload); err != nil {
+			return err
+		}
+	}
+
+	recipients, err := s.recipients(request.Recipients)
+	if err != nil {
+		return err
+	}
+
 	id := uuid.New()
+
+	tr := newTransfer(request.NumOfChunks, s.windowSize)
+	tr.Digest = request.Digest
+	tr.Metadata = request.Metadata
+	tr.Recipients = recipients
+	if user != nil {
+		tr.Owner = user.ID
+	}
+	if request.StoreAndForward {
+		// the receiver is not expected to be online, so the sender is not limited by the window
+		tr.StoreAndForward = true
+		tr.ExpiresAt = time.Now().Add(s.disk.retention)
+		tr.Window.Size = 0
+	}
+
+	if err := s.save(id, tr); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.data[id] = tr
+	s.lock.Unlock()
+
 	response.TransferID = id
 	return nil
 }
@@ -66,117 +276,518 @@ func (s *Service) InitUpload(request *InitUploadRequest, response *InitUploadRes
 type UploadChunkRequest struct {
 	TransferID  string
 	ChunkNumber int
-	Content     string // base64 segment content
+	Payload     []byte        // raw segment content
+	Content     string        // base64 segment content, only used by clients without Payload support
+	Digest      []byte        // SHA-256 of the decoded content
+	Timeout     time.Duration // how long to wait for the chunk to fit into the window, see MaxWait
+	Token       string        // issued by Login
+}
+
+// data returns the raw chunk sent either as Payload or as base64 Content
+func (r *UploadChunkRequest) data() ([]byte, error) {
+	if r.Payload != nil {
+		return r.Payload, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(r.Content)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode chunk %d: %w", r.ChunkNumber, err)
+	}
+
+	return data, nil
 }
 
 type UploadChunkResponse struct {
 }
 
+// UploadChunk stores the chunk, it blocks up to request.Timeout while the window is full
 func (s *Service) UploadChunk(request *UploadChunkRequest, _ *UploadChunkResponse) error {
-	if len(request.Content) > 3.5*1024*1024 {
-		return fmt.Errorf("refejcted, chunk %d is too big (%d)", request.ChunkNumber, len(request.Content))
+	if len(request.Payload) > s.maxChunkSize || len(request.Content) > base64.StdEncoding.EncodedLen(s.maxChunkSize) {
+		return fmt.Errorf("rejected, chunk %d is too big (%d)", request.ChunkNumber, len(request.Payload)+len(request.Content))
 	}
 
-	s.lock.Lock()
-	defer s.lock.Unlock()
-
 	trID, err := uuid.Parse(request.TransferID)
 	if err != nil {
 		return fmt.Errorf("cannot parse transfer id %s: %w", request.TransferID, err)
 	}
 
-	segment, ok := s.data[trID]
-	if ok {
-		return fmt.Errorf("transfer id was not found: %q", request)
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	// decoding and hashing do not need the transfer, so other calls are not held up by them
+	data, err := request.data()
+	if err != nil {
+		return err
+	}
+
+	if err := verify(request.ChunkNumber, data, request.Digest); err != nil {
+		return err
+	}
+
+	tr, err := s.get(trID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.Unlock()
+
+	if err := tr.allow(user, accessSend); err != nil {
+		return err
+	}
+
+	until := deadline(request.Timeout)
+
+	var store bool
+	for {
+		if err := tr.alive(trID); err != nil {
+			return err
+		}
+
+		if err := tr.expect("UploadChunk", StateCreated, StateUploading); err != nil {
+			return err
+		}
+
+		if request.ChunkNumber < 0 || ((tr.NumOfChunks > 0 || tr.StoreAndForward) && request.ChunkNumber >= tr.NumOfChunks) {
+			return fmt.Errorf("chunk %d is out of declared %d chunks", request.ChunkNumber, tr.NumOfChunks)
+		}
+
+		if tr.StoreAndForward && len(data) != tr.Metadata.chunkLen(request.ChunkNumber) {
+			return fmt.Errorf("chunk %d has %d bytes, %d declared", request.ChunkNumber, len(data), tr.Metadata.chunkLen(request.ChunkNumber))
+		}
+
+		store, err = tr.Window.fits(request.ChunkNumber)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, ErrWindowFull) || !wait(&tr.lock, tr, until) {
+			return err
+		}
+	}
+
+	if store {
+		if err := s.store(tr).Put(trID, request.ChunkNumber, data); err != nil {
+			return fmt.Errorf("cannot store chunk %d: %w", request.ChunkNumber, err)
+		}
+
+		tr.Window.put(request.ChunkNumber)
+		tr.Digests[request.ChunkNumber] = request.Digest
+	}
+
+	if tr.State == StateUploading {
+		s.touch(trID, tr)
+		return nil
+	}
+
+	tr.State = StateUploading
+	return s.save(trID, tr)
+}
+
+type CompleteUploadRequest struct {
+	TransferID  TransferID
+	NumOfChunks int    // number of chunks the sender has uploaded, numbered from 0
+	Token       string // issued by Login
+}
+
+type CompleteUploadResponse struct {
+	State State
+}
+
+// CompleteUpload is called by the sender after the last chunk was uploaded
+func (s *Service) CompleteUpload(request *CompleteUploadRequest, response *CompleteUploadResponse) error {
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	tr, err := s.get(request.TransferID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.Unlock()
+
+	if err := tr.allow(user, accessSend); err != nil {
+		return err
+	}
+
+	if err := tr.expect("CompleteUpload", StateCreated, StateUploading); err != nil {
+		return err
+	}
+
+	if !tr.Window.uploaded(request.NumOfChunks) || (tr.NumOfChunks > 0 && tr.NumOfChunks != request.NumOfChunks) {
+		tr.finish(StateFailed, fmt.Sprintf("sender reported %d chunks, declared %d", request.NumOfChunks, tr.NumOfChunks))
+		if err := s.store(tr).DeleteAll(request.TransferID); err != nil {
+			log.Printf("cannot release chunks of failed transfer %v: %v", request.TransferID, err)
+		}
+
+		if err := s.save(request.TransferID, tr); err != nil {
+			log.Printf("cannot save failed transfer: %v", err)
+		}
+
+		return fmt.Errorf("transfer %v failed: sender reported %d chunks, declared %d, not all of them were uploaded",
+			request.TransferID, request.NumOfChunks, tr.NumOfChunks)
+	}
+
+	tr.NumOfChunks = request.NumOfChunks
+	tr.finishUpload()
+	response.State = tr.State
+	return s.save(request.TransferID, tr)
+}
+
+type ResumeUploadRequest struct {
+	TransferID TransferID
+	Token      string // issued by Login
+}
+
+type ResumeUploadResponse struct {
+	NextChunk   int // the lowest chunk the server has not received
+	NumOfChunks int
+	ChunkSize   int
+	Digest      []byte // SHA-256 of the whole file declared on init
+	State       State
+}
+
+// ResumeUpload lets the sender continue the interrupted upload
+func (s *Service) ResumeUpload(request *ResumeUploadRequest, response *ResumeUploadResponse) error {
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	tr, err := s.view(request.TransferID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.RUnlock()
+
+	if err := tr.allow(user, accessSend); err != nil {
+		return err
 	}
 
-	if segment.Number != nullCurrentSegmentID {
-		return fmt.Errorf("segment was not yet downloaded")
+	if err := tr.expect("ResumeUpload", StateCreated, StateUploading, StateAwaitingAck); err != nil {
+		return err
 	}
 
-	s.data[trID] = CurrentSegment{Number: request.ChunkNumber, Data: request.Content}
+	response.NextChunk = tr.Window.next()
+	response.NumOfChunks = tr.NumOfChunks
+	response.ChunkSize = tr.Metadata.ChunkSize
+	response.Digest = tr.Digest
+	response.State = tr.State
 	return nil
 }
 
 type DownloadChunkRequest struct {
-	TransferID
+	TransferID  TransferID
 	ChunkNumber int
+	Raw         bool          // send the segment as Payload instead of base64 Data
+	Timeout     time.Duration // how long to wait for the chunk to be uploaded, see MaxWait
+	Token       string        // issued by Login
 }
 
 type DownloadChunkResponse struct {
-	TransferID
+	TransferID  TransferID
 	ChunkNumber int
-	Data        string // base64 encoded file segment
+	Payload     []byte // raw file segment if it was requested
+	Data        string // base64 encoded file segment for clients without Payload support
+	Digest      []byte // SHA-256 of the decoded segment declared by the sender
 }
 
+// DownloadChunk returns the uploaded chunk, it blocks up to request.Timeout until the sender uploads it
+// or the transfer is completed. ErrChunkNotAvailable is returned at once if the chunk was acknowledged.
 func (s *Service) DownloadChunk(request *DownloadChunkRequest, response *DownloadChunkResponse) error {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
 
-	segment, ok := s.data[request.TransferID]
-	if !ok {
-		return fmt.Errorf("cannot find tranfer with id %v", request.TransferID)
+	tr, err := s.view(request.TransferID)
+	if err != nil {
+		return err
 	}
+	defer tr.lock.RUnlock()
 
-	if segment.Number == nullCurrentSegmentID {
-		return fmt.Errorf("the segment %q was not uploaded yet", request)
+	if err := tr.allow(user, accessReceive); err != nil {
+		return err
 	}
 
-	if segment.Number != request.ChunkNumber {
-		return fmt.Errorf("the segment with id %d is not available", segment.Number)
+	until := deadline(request.Timeout)
+
+	for {
+		if err := tr.alive(request.TransferID); err != nil {
+			return err
+		}
+
+		if err := tr.expect("DownloadChunk", StateCreated, StateUploading, StateAwaitingAck, StateCompleted); err != nil {
+			return err
+		}
+
+		if tr.Window.pending(request.ChunkNumber) {
+			break
+		}
+
+		// acknowledged chunks are not pending, but stay received until the window moves past them.
+		// Chunks past the end are waited for like the others, so the receiver learns of the completed transfer without polling.
+		never := tr.State == StateCompleted || request.ChunkNumber < tr.Window.Base || tr.Window.Received[request.ChunkNumber]
+		if never || !wait(tr.lock.RLocker(), tr, until) {
+			return fmt.Errorf("%w: chunk %d", ErrChunkNotAvailable, request.ChunkNumber)
+		}
+	}
+
+	data, err := s.store(tr).Get(request.TransferID, request.ChunkNumber)
+	if err != nil {
+		return err
+	}
+
+	response.TransferID = request.TransferID
+	response.ChunkNumber = request.ChunkNumber
+	if request.Raw {
+		response.Payload = data
+	} else {
+		response.Data = base64.StdEncoding.EncodeToString(data)
 	}
 
-	response.ChunkNumber = segment.Number
-	response.Data = segment.Data
+	response.Digest = tr.Digests[request.ChunkNumber]
 	return nil
 }
 
 type ConfirmChunkDownloadedRequest struct {
-	TransferID
+	TransferID  TransferID
 	ChunkNumber int
+	Token       string // issued by Login
 }
 
 type ConfirmChunkDownloadedResponse struct {
 }
 
 func (s *Service) ConfirmChunkDownloaded(request *ConfirmChunkDownloadedRequest, _ *ConfirmChunkDownloadedResponse) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
 
-	_, ok := s.data[request.TransferID]
-	if !ok {
-		log.Printf("Did not find the segment %q on ConfirmDownload", request)
+	tr, err := s.get(request.TransferID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.Unlock()
+
+	if err := tr.allow(user, accessReceive); err != nil {
+		return err
+	}
+
+	if err := tr.expect("ConfirmChunkDownloaded", StateUploading, StateAwaitingAck); err != nil {
+		return err
+	}
+
+	// transfers open to any user are listed for the one who received them
+	if user != nil && user.ID != tr.Owner && tr.Receiver == 0 {
+		tr.Receiver = user.ID
+	}
+
+	acked, err := tr.Window.ack(request.ChunkNumber)
+	if err != nil {
+		log.Printf("cannot confirm chunk %d of %v: %v", request.ChunkNumber, request.TransferID, err)
+		return err
+	}
+
+	if acked {
+		delete(tr.Digests, request.ChunkNumber)
+		if err := s.store(tr).Delete(request.TransferID, request.ChunkNumber); err != nil {
+			return fmt.Errorf("cannot release chunk %d: %w", request.ChunkNumber, err)
+		}
+	}
+
+	if tr.State == StateAwaitingAck {
+		tr.finishUpload()
+	}
+
+	if tr.State != StateCompleted {
+		s.touch(request.TransferID, tr)
 		return nil
 	}
 
-	if err := s.setNullCurrentSegment(request.TransferID); err != nil {
-		return fmt.Errorf("cannot set null current segment: %w", err)
+	if err := s.store(tr).DeleteAll(request.TransferID); err != nil {
+		log.Printf("cannot release chunks of completed transfer %v: %v", request.TransferID, err)
 	}
 
-	return nil
+	return s.save(request.TransferID, tr)
 }
 
 type GetCurrentSegmentNumberRequest struct {
-	TransferID
+	TransferID TransferID
+	Token      string // issued by Login
 }
 
 type GetCurrentSegmentNumberResponse struct {
-	ChunkNumber int
+	ChunkNumber int // the lowest chunk waiting to be downloaded or NullCurrentSegmentID
+	NumOfChunks int // 0 until the sender declared the number of chunks
+	State       State
 }
 
 func (s *Service) GetCurrentSegmentNumber(request *GetCurrentSegmentNumberRequest, response *GetCurrentSegmentNumberResponse) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
 
-	segment, ok := s.data[request.TransferID]
-	if !ok {
-		return fmt.Errorf("transfer with id %q does not exist", request.TransferID)
+	tr, err := s.view(request.TransferID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.RUnlock()
+
+	if err := tr.allow(user, accessWatch); err != nil {
+		return err
+	}
+
+	response.ChunkNumber = NullCurrentSegmentID
+	if available := tr.Window.available(); len(available) > 0 {
+		response.ChunkNumber = available[0]
+	}
+
+	response.NumOfChunks = tr.NumOfChunks
+	response.State = tr.State
+	return nil
+}
+
+type GetWindowRequest struct {
+	TransferID TransferID
+	Token      string // issued by Login
+}
+
+type GetWindowResponse struct {
+	Base        int    // every chunk below was acknowledged
+	Size        int    // uploads are accepted for chunks in [Base, Base+Size), 0 if not limited
+	Available   []int  // sorted chunks waiting to be downloaded
+	Acked       []int  // sorted chunks above Base acknowledged out of order, the receiver has them already; nil if finished
+	NumOfChunks int    // 0 until the sender declared the number of chunks
+	Digest      []byte // SHA-256 of the whole file declared by the sender
+	State       State
+	Reason      string // why the transfer has failed or was cancelled
+}
+
+func (s *Service) GetWindow(request *GetWindowRequest, response *GetWindowResponse) error {
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	tr, err := s.view(request.TransferID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.RUnlock()
+
+	if err := tr.allow(user, accessWatch); err != nil {
+		return err
+	}
+
+	response.Base = tr.Window.Base
+	response.Size = tr.Window.Size
+	response.Available = tr.Window.available()
+	// finished transfers drop their pending chunks, so the received ones no longer tell acknowledged chunks
+	if !tr.State.Finished() {
+		response.Acked = tr.Window.acknowledged()
+	}
+
+	response.NumOfChunks = tr.NumOfChunks
+	response.Digest = tr.Digest
+	response.State = tr.State
+	response.Reason = tr.Reason
+	return nil
+}
+
+type GetTransferInfoRequest struct {
+	TransferID TransferID
+	Token      string // issued by Login
+}
+
+type GetTransferInfoResponse struct {
+	Metadata        Metadata
+	NumOfChunks     int
+	Digest          []byte // SHA-256 of the whole file declared by the sender
+	StoreAndForward bool
+	ExpiresAt       time.Time // zero if the transfer does not expire
+	State           State
+	Owner           uint64 // user who created the transfer, 0 if users are not checked
+}
+
+// GetTransferInfo describes the file, so the receiver knows what to expect
+func (s *Service) GetTransferInfo(request *GetTransferInfoRequest, response *GetTransferInfoResponse) error {
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
 	}
 
-	if segment.Number == nullCurrentSegmentID {
-		return fmt.Errorf("transfer is not initialized yet")
+	tr, err := s.view(request.TransferID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.RUnlock()
+
+	if err := tr.allow(user, accessWatch); err != nil {
+		return err
 	}
 
-	response.ChunkNumber = segment.Number
+	response.Metadata = tr.Metadata
+	response.NumOfChunks = tr.NumOfChunks
+	response.Digest = tr.Digest
+	response.StoreAndForward = tr.StoreAndForward
+	response.ExpiresAt = tr.ExpiresAt
+	response.State = tr.State
+	response.Owner = tr.Owner
 	return nil
 }
+
+type CancelTransferRequest struct {
+	TransferID TransferID
+	Reason     string
+	Token      string // issued by Login
+}
+
+type CancelTransferResponse struct {
+}
+
+// CancelTransfer stops the transfer on behalf of the sender or a recipient named by them,
+// transfers open to any user are cancelled only by the sender. Further calls of the other side fail with ErrCancelled
+func (s *Service) CancelTransfer(request *CancelTransferRequest, _ *CancelTransferResponse) error {
+	user, err := s.authenticate(request.Token)
+	if err != nil {
+		return err
+	}
+
+	tr, err := s.get(request.TransferID)
+	if err != nil {
+		return err
+	}
+	defer tr.lock.Unlock()
+
+	if err := tr.allow(user, accessCancel); err != nil {
+		return err
+	}
+
+	if tr.State == StateCancelled {
+		return nil
+	}
+
+	if err := tr.expect("CancelTransfer", StateCreated, StateUploading, StateAwaitingAck); err != nil {
+		return err
+	}
+
+	reason := request.Reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+
+	if err := s.store(tr).DeleteAll(request.TransferID); err != nil {
+		log.Printf("cannot release chunks of cancelled transfer %v: %v", request.TransferID, err)
+	}
+
+	tr.Window.Pending = make(map[int]bool)
+	tr.Digests = make(map[int][]byte)
+	tr.finish(StateCancelled, reason)
+	log.Printf("transfer %v cancelled: %s", request.TransferID, reason)
+
+	return s.save(request.TransferID, tr)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/eqr/transferit/app/config"
+)
+
+// users authenticates the token equal to the login of the user
+type users map[string]User
+
+func (u users) Authenticate(token string) (User, error) {
+	return u.Lookup(token)
+}
+
+func (u users) Login(login string, _ string) (string, error) {
+	return login, nil
+}
+
+func (u users) Lookup(login string) (User, error) {
+	user, ok := u[login]
+	if !ok {
+		return User{}, fmt.Errorf("no user %s", login)
+	}
+
+	return user, nil
+}
+
+var testUsers = users{
+	"alice": {ID: 1, Login: "alice"},
+	"bob":   {ID: 2, Login: "bob"},
+	"carol": {ID: 3, Login: "carol"},
+}
+
+func testConfig(t *testing.T, storeAndForward bool) *config.Config {
+	cfg := &config.Config{}
+	cfg.Transfer.WindowSize = 4
+	cfg.Transfer.StoreAndForward = storeAndForward
+	cfg.WorkDir.Path = filepath.Join(t.TempDir(), "chunks")
+	return cfg
+}
+
+func openDB(t *testing.T, path string) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func newService(t *testing.T, cfg *config.Config, db *bolt.DB) *Service {
+	t.Helper()
+	srv, err := New(cfg, db, testUsers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv
+}
+
+// send starts the transfer of the chunks from alice
+func send(t *testing.T, srv *Service, storeAndForward bool, recipients []string, chunks ...[]byte) TransferID {
+	t.Helper()
+	var size int64
+	var file []byte
+	for _, chunk := range chunks {
+		size += int64(len(chunk))
+		file = append(file, chunk...)
+	}
+
+	chunkSize := 0
+	if len(chunks) > 0 {
+		chunkSize = len(chunks[0])
+	}
+
+	request := &InitUploadRequest{
+		NumOfChunks:     len(chunks),
+		StoreAndForward: storeAndForward,
+		Digest:          Digest(file),
+		Metadata:        Metadata{Name: "file", Size: size, ChunkSize: chunkSize},
+		Recipients:      recipients,
+		Token:           "alice",
+	}
+
+	var response InitUploadResponse
+	if err := srv.InitUpload(request, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	return response.TransferID
+}
+
+func upload(t *testing.T, srv *Service, id TransferID, number int, data []byte) {
+	t.Helper()
+	request := &UploadChunkRequest{TransferID: id.String(), ChunkNumber: number, Payload: data, Digest: Digest(data), Token: "alice"}
+	if err := srv.UploadChunk(request, &UploadChunkResponse{}); err != nil {
+		t.Fatalf("cannot upload chunk %d: %v", number, err)
+	}
+}
+
+func receive(t *testing.T, srv *Service, id TransferID, number int, token string) []byte {
+	t.Helper()
+	var response DownloadChunkResponse
+	if err := srv.DownloadChunk(&DownloadChunkRequest{TransferID: id, ChunkNumber: number, Raw: true, Token: token}, &response); err != nil {
+		t.Fatalf("cannot download chunk %d: %v", number, err)
+	}
+
+	if err := srv.ConfirmChunkDownloaded(&ConfirmChunkDownloadedRequest{TransferID: id, ChunkNumber: number, Token: token}, &ConfirmChunkDownloadedResponse{}); err != nil {
+		t.Fatalf("cannot confirm chunk %d: %v", number, err)
+	}
+
+	return response.Payload
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is a step of the transfer lifecycle
+type State string
+
+const (
+	StateCreated     State = "created"      // InitUpload was called, nothing uploaded yet
+	StateUploading   State = "uploading"    // sender is uploading chunks
+	StateAwaitingAck State = "awaiting-ack" // sender is finished, receiver has not confirmed all chunks yet
+	StateCompleted   State = "completed"    // every chunk was downloaded and confirmed
+	StateFailed      State = "failed"
+	StateCancelled   State = "cancelled" // CancelTransfer was called by one of the sides, see Reason
+	StateExpired     State = "expired"   // removed by the janitor, see Reason
+)
+
+// Finished reports if no more calls can change the transfer
+func (st State) Finished() bool {
+	return st == StateCompleted || st == StateFailed || st == StateCancelled || st == StateExpired
+}
+
+type transfer struct {
+	State           State
+	Reason          string // why the transfer has failed, expired or was cancelled
+	CreatedAt       time.Time
+	UpdatedAt       time.Time // last time the transfer made progress
+	FinishedAt      time.Time
+	NumOfChunks     int  // declared by the sender, 0 if unknown
+	StoreAndForward bool // chunks are kept in the work dir instead of memory
+	ExpiresAt       time.Time
+	Metadata        Metadata
+	Owner           uint64         // user who created the transfer, 0 if users are not checked
+	Recipients      []uint64       // users allowed to download, any user if empty
+	Receiver        uint64         // user who acknowledged the first chunk, 0 until then or if it is the owner
+	Digest          []byte         // SHA-256 of the whole file declared by the sender
+	Digests         map[int][]byte // SHA-256 of the chunks waiting for acknowledgement
+	Window          *window
+
+	contents map[int][]byte // chunks kept in memory, see memoryStore
+	lock     sync.RWMutex   // guards every field above
+	changed  chan struct{}  // closed on every change, see notify
+	version  uint64         // number of changes since the transfer was loaded
+}
+
+func newTransfer(numOfChunks int, windowSize int) *transfer {
+	now := time.Now()
+	return &transfer{
+		State:       StateCreated,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		NumOfChunks: numOfChunks,
+		Digests:     make(map[int][]byte),
+		Window:      newWindow(windowSize),
+		changed:     make(chan struct{}),
+	}
+}
+
+// expired reports if the stored transfer was not downloaded in time
+func (t *transfer) expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
+
+// alive returns ErrExpired if the transfer can not be used anymore
+func (t *transfer) alive(id TransferID) error {
+	if t.State == StateExpired || t.expired(time.Now()) {
+		return fmt.Errorf("%w: %v", ErrExpired, id)
+	}
+
+	return nil
+}
+
+// expect returns an error if the transfer is not in one of the states
+func (t *transfer) expect(call string, states ...State) error {
+	if t.State == StateCancelled {
+		return fmt.Errorf("%w: %s", ErrCancelled, t.Reason)
+	}
+
+	for _, st := range states {
+		if t.State == st {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s is not allowed for %s transfer", ErrInvalidState, call, t.State)
+}
+
+// finishUpload moves the transfer to the final state once the sender is done and everything is acked
+func (t *transfer) finishUpload() {
+	if t.Window.acked() {
+		t.finish(StateCompleted, "")
+	} else {
+		t.State = StateAwaitingAck
+	}
+}
+
+// notify wakes up calls waiting for the transfer to change
+func (t *transfer) notify() {
+	t.version++
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func (t *transfer) finish(state State, reason string) {
+	t.State = state
+	t.Reason = reason
+	t.FinishedAt = time.Now()
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// chunkStore keeps contents of the uploaded chunks until they are acknowledged
+type chunkStore interface {
+	Put(id TransferID, number int, data []byte) error
+	Get(id TransferID, number int) ([]byte, error)
+	Delete(id TransferID, number int) error
+	DeleteAll(id TransferID) error
+}
+
+// memoryStore keeps the chunks on their transfer, the callers hold the lock of the transfer,
+// so transfers do not wait for each other
+type memoryStore struct {
+	tr *transfer
+}
+
+func (m memoryStore) Put(_ TransferID, number int, data []byte) error {
+	if m.tr.contents == nil {
+		m.tr.contents = make(map[int][]byte)
+	}
+
+	m.tr.contents[number] = data
+	return nil
+}
+
+func (m memoryStore) Get(_ TransferID, number int) ([]byte, error) {
+	data, ok := m.tr.contents[number]
+	if !ok {
+		return nil, fmt.Errorf("%w: chunk %d", ErrChunkNotAvailable, number)
+	}
+
+	return data, nil
+}
+
+func (m memoryStore) Delete(_ TransferID, number int) error {
+	delete(m.tr.contents, number)
+	return nil
+}
+
+func (m memoryStore) DeleteAll(_ TransferID) error {
+	m.tr.contents = nil
+	return nil
+}
+
+var chunksBucket = []byte("chunks")
+
+// storedChunk is the index record of the chunk written to the work dir
+type storedChunk struct {
+	Path      string
+	Size      int
+	ExpiresAt time.Time
+}
+
+// diskStore writes chunks to the work dir and indexes them in the db,
+// so they can be downloaded long after the sender has gone
+type diskStore struct {
+	dir       string
+	db        *bolt.DB
+	retention time.Duration
+}
+
+func newDiskStore(dir string, db *bolt.DB, retention time.Duration) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create work dir %s: %w", dir, err)
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(chunksBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot validate chunks bucket: %w", err)
+	}
+
+	return &diskStore{dir: dir, db: db, retention: retention}, nil
+}
+
+func chunkKey(id TransferID, number int) []byte {
+	return []byte(id.String() + "/" + strconv.Itoa(number))
+}
+
+func (d *diskStore) Put(id TransferID, number int, data []byte) error {
+	dir := filepath.Join(d.dir, id.String())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("cannot create transfer dir: %w", err)
+	}
+
+	path := filepath.Join(dir, strconv.Itoa(number)+".chunk")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("cannot write chunk %d: %w", number, err)
+	}
+
+	record := storedChunk{Path: path, Size: len(data), ExpiresAt: time.Now().Add(d.retention)}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return fmt.Errorf("error encoding chunk record: %w", err)
+	}
+
+	// concurrent uploads share the db commit
+	return d.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunksBucket).Put(chunkKey(id, number), buf.Bytes())
+	})
+}
+
+func (d *diskStore) record(id TransferID, number int) (storedChunk, error) {
+	var record storedChunk
+	err := d.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(chunksBucket).Get(chunkKey(id, number))
+		if v == nil {
+			return fmt.Errorf("%w: chunk %d", ErrChunkNotAvailable, number)
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&record)
+	})
+
+	return record, err
+}
+
+// has reports if the chunk is in the work dir
+func (d *diskStore) has(id TransferID, number int) bool {
+	_, err := d.record(id, number)
+	return err == nil
+}
+
+func (d *diskStore) Get(id TransferID, number int) ([]byte, error) {
+	record, err := d.record(id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(record.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read chunk %d: %w", number, err)
+	}
+
+	return data, nil
+}
+
+func (d *diskStore) Delete(id TransferID, number int) error {
+	record, err := d.record(id, number)
+	if err != nil {
+		return nil
+	}
+
+	if err := os.Remove(record.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove chunk %d: %w", number, err)
+	}
+
+	return d.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunksBucket).Delete(chunkKey(id, number))
+	})
+}
+
+func (d *diskStore) DeleteAll(id TransferID) error {
+	prefix := []byte(id.String() + "/")
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(chunksBucket)
+
+		// deleting with the cursor skips records, so collect the keys first
+		var keys [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+
+		return deleteKeys(bucket, keys)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot remove chunk records of %v: %w", id, err)
+	}
+
+	return os.RemoveAll(filepath.Join(d.dir, id.String()))
+}
+
+// purgeExpired removes chunks which were not downloaded in time
+func (d *diskStore) purgeExpired(now time.Time) error {
+	var expired []string
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(chunksBucket)
+
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record storedChunk
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&record); err != nil {
+				return fmt.Errorf("error decoding chunk record %s: %w", k, err)
+			}
+
+			if now.After(record.ExpiresAt) {
+				expired = append(expired, record.Path)
+				keys = append(keys, k)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return deleteKeys(bucket, keys)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range expired {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("cannot remove expired chunk %s: %v", path, err)
+		}
+	}
+
+	if len(expired) > 0 {
+		log.Printf("removed %d expired chunks", len(expired))
+	}
+
+	return nil
+}
+
+func deleteKeys(bucket *bolt.Bucket, keys [][]byte) error {
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return fmt.Errorf("cannot delete record %s: %w", k, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// maxWait limits how long UploadChunk and DownloadChunk may block
+const maxWait = 30 * time.Second
+
+// deadline returns when the blocking call has to give up, timeouts above maxWait are lowered
+func deadline(timeout time.Duration) time.Time {
+	if timeout > maxWait {
+		timeout = maxWait
+	}
+
+	return time.Now().Add(timeout)
+}
+
+// wait releases the lock until the transfer changes or the deadline passes,
+// it returns false if the deadline has passed
+func wait(lock sync.Locker, tr *transfer, until time.Time) bool {
+	timeout := time.Until(until)
+	if timeout <= 0 {
+		return false
+	}
+
+	changed := tr.changed
+	lock.Unlock()
+	defer lock.Lock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
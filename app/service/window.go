@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+)
+
+// window tracks chunks that were uploaded but not yet acknowledged by the receiver.
+// Uploads are accepted for chunk numbers in [Base, Base+Size) in any order,
+// Base moves forward once the receiver acknowledged every chunk below it.
+// Size 0 means the window is not bounded.
+type window struct {
+	Base     int
+	Size     int
+	Pending  map[int]bool // chunks waiting for acknowledgement
+	Received map[int]bool // chunks in the window that were uploaded, acknowledged or not
+}
+
+func newWindow(size int) *window {
+	return &window{
+		Size:     size,
+		Pending:  make(map[int]bool),
+		Received: make(map[int]bool),
+	}
+}
+
+// fits reports if the chunk has to be stored, uploading the chunk that was already acknowledged is a no-op
+func (w *window) fits(number int) (bool, error) {
+	if number < w.Base || (w.Received[number] && !w.pending(number)) {
+		return false, nil
+	}
+
+	if w.Size > 0 && number >= w.Base+w.Size {
+		return false, fmt.Errorf("%w: chunk %d is out of window [%d, %d)", ErrWindowFull, number, w.Base, w.Base+w.Size)
+	}
+
+	return true, nil
+}
+
+func (w *window) put(number int) {
+	w.Pending[number] = true
+	w.Received[number] = true
+}
+
+// ack moves the window, it returns false if the chunk was already acknowledged
+func (w *window) ack(number int) (bool, error) {
+	if number < w.Base || (w.Received[number] && !w.pending(number)) {
+		return false, nil
+	}
+
+	if !w.pending(number) {
+		return false, fmt.Errorf("%w: chunk %d", ErrChunkNotAvailable, number)
+	}
+
+	delete(w.Pending, number)
+	for w.Received[w.Base] && !w.pending(w.Base) {
+		delete(w.Received, w.Base)
+		w.Base++
+	}
+
+	return true, nil
+}
+
+func (w *window) pending(number int) bool {
+	return w.Pending[number]
+}
+
+// acked reports if the receiver confirmed every uploaded chunk
+func (w *window) acked() bool {
+	return len(w.Pending) == 0
+}
+
+// uploaded reports if every chunk in [0, numOfChunks) was uploaded and nothing above
+func (w *window) uploaded(numOfChunks int) bool {
+	if numOfChunks < w.Base || len(w.Received) != numOfChunks-w.Base {
+		return false
+	}
+
+	for number := range w.Received {
+		if number >= numOfChunks {
+			return false
+		}
+	}
+
+	return true
+}
+
+// next returns the lowest chunk which was not uploaded yet
+func (w *window) next() int {
+	number := w.Base
+	for w.Received[number] {
+		number++
+	}
+
+	return number
+}
+
+// available returns sorted numbers of chunks waiting for acknowledgement
+func (w *window) available() []int {
+	numbers := make([]int, 0, len(w.Pending))
+	for number := range w.Pending {
+		numbers = append(numbers, number)
+	}
+
+	sort.Ints(numbers)
+	return numbers
+}
+
+// acknowledged returns sorted numbers of chunks above Base which were acknowledged out of order
+func (w *window) acknowledged() []int {
+	numbers := make([]int, 0, len(w.Received)-len(w.Pending))
+	for number := range w.Received {
+		if !w.pending(number) {
+			numbers = append(numbers, number)
+		}
+	}
+
+	sort.Ints(numbers)
+	return numbers
+}
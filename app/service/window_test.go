@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// step uploads or acknowledges a chunk and expects the result of fits or ack
+type step struct {
+	op     string // put or ack
+	number int
+	ok     bool
+	err    error
+}
+
+func put(number int, ok bool, err error) step {
+	return step{op: "put", number: number, ok: ok, err: err}
+}
+
+func ack(number int, ok bool, err error) step {
+	return step{op: "ack", number: number, ok: ok, err: err}
+}
+
+func sameInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		name         string
+		size         int
+		steps        []step
+		base         int
+		next         int
+		available    []int
+		acknowledged []int
+		numOfChunks  int // checked with uploaded
+		uploaded     bool
+	}{
+		{
+			name:        "in order",
+			size:        4,
+			steps:       []step{put(0, true, nil), put(1, true, nil), ack(0, true, nil), ack(1, true, nil)},
+			base:        2,
+			next:        2,
+			numOfChunks: 2,
+			uploaded:    true,
+		},
+		{
+			name:         "acks out of order",
+			size:         4,
+			steps:        []step{put(0, true, nil), put(1, true, nil), put(2, true, nil), ack(2, true, nil), ack(1, true, nil)},
+			base:         0,
+			next:         3,
+			available:    []int{0},
+			acknowledged: []int{1, 2},
+			numOfChunks:  3,
+			uploaded:     true,
+		},
+		{
+			name:        "base moves over chunks acknowledged out of order",
+			size:        4,
+			steps:       []step{put(0, true, nil), put(1, true, nil), put(2, true, nil), ack(2, true, nil), ack(1, true, nil), ack(0, true, nil)},
+			base:        3,
+			next:        3,
+			numOfChunks: 3,
+			uploaded:    true,
+		},
+		{
+			name:        "uploads out of order",
+			size:        4,
+			steps:       []step{put(2, true, nil), put(0, true, nil)},
+			base:        0,
+			next:        1,
+			available:   []int{0, 2},
+			numOfChunks: 3,
+			uploaded:    false,
+		},
+		{
+			name:        "full window",
+			size:        2,
+			steps:       []step{put(0, true, nil), put(1, true, nil), put(2, false, ErrWindowFull), ack(0, true, nil), put(2, true, nil), put(4, false, ErrWindowFull)},
+			base:        1,
+			next:        3,
+			available:   []int{1, 2},
+			numOfChunks: 3,
+			uploaded:    true,
+		},
+		{
+			name:        "unbounded window",
+			size:        0,
+			steps:       []step{put(0, true, nil), put(100, true, nil)},
+			base:        0,
+			next:        1,
+			available:   []int{0, 100},
+			numOfChunks: 2,
+			uploaded:    false,
+		},
+		{
+			name:      "pending chunk uploaded again",
+			size:      4,
+			steps:     []step{put(0, true, nil), put(0, true, nil)},
+			base:      0,
+			next:      1,
+			available: []int{0},
+		},
+		{
+			name:         "acknowledged chunks uploaded again",
+			size:         4,
+			steps:        []step{put(0, true, nil), put(1, true, nil), ack(0, true, nil), ack(1, true, nil), put(0, false, nil), put(1, false, nil), put(2, true, nil), put(3, true, nil), ack(3, true, nil), put(3, false, nil)},
+			base:         2,
+			next:         4,
+			available:    []int{2},
+			acknowledged: []int{3},
+			numOfChunks:  4,
+			uploaded:     true,
+		},
+		{
+			name:        "acknowledged twice",
+			size:        4,
+			steps:       []step{put(0, true, nil), put(1, true, nil), ack(1, true, nil), ack(1, false, nil), ack(0, true, nil), ack(0, false, nil)},
+			base:        2,
+			next:        2,
+			numOfChunks: 2,
+			uploaded:    true,
+		},
+		{
+			name:        "chunk not uploaded",
+			size:        4,
+			steps:       []step{put(0, true, nil), ack(1, false, ErrChunkNotAvailable)},
+			base:        0,
+			next:        1,
+			available:   []int{0},
+			numOfChunks: 1,
+			uploaded:    true,
+		},
+		{
+			name:        "chunk above the end",
+			size:        4,
+			steps:       []step{put(0, true, nil), put(2, true, nil)},
+			next:        1,
+			available:   []int{0, 2},
+			numOfChunks: 1,
+			uploaded:    false,
+		},
+		{
+			name:        "nothing uploaded",
+			size:        4,
+			numOfChunks: 0,
+			uploaded:    true,
+		},
+	}
+
+	for _, test := range tests {
+		w := newWindow(test.size)
+		for i, s := range test.steps {
+			var ok bool
+			var err error
+			switch s.op {
+			case "put":
+				if ok, err = w.fits(s.number); ok {
+					w.put(s.number)
+				}
+			case "ack":
+				ok, err = w.ack(s.number)
+			}
+
+			if ok != s.ok || !errors.Is(err, s.err) || (err == nil) != (s.err == nil) {
+				t.Errorf("%s: step %d, %s %d: got %v, %v, expected %v, %v", test.name, i, s.op, s.number, ok, err, s.ok, s.err)
+			}
+		}
+
+		got := fmt.Sprintf("base %d, next %d, available %v, acknowledged %v, uploaded %v",
+			w.Base, w.next(), w.available(), w.acknowledged(), w.uploaded(test.numOfChunks))
+		if w.Base != test.base || w.next() != test.next || !sameInts(w.available(), test.available) ||
+			!sameInts(w.acknowledged(), test.acknowledged) || w.uploaded(test.numOfChunks) != test.uploaded {
+			t.Errorf("%s: got %s, expected base %d, next %d, available %v, acknowledged %v, uploaded %v",
+				test.name, got, test.base, test.next, test.available, test.acknowledged, test.uploaded)
+		}
+
+		if w.acked() != (len(test.available) == 0) {
+			t.Errorf("%s: acked %v with chunks %v pending", test.name, w.acked(), test.available)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tokens
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eqr/transferit/app/service"
+)
+
+// Service manages API tokens over rpc, callers need the admin scope
+type Service struct {
+	store *Store
+	auth  service.Authenticator
+}
+
+func NewService(store *Store, auth service.Authenticator) *Service {
+	return &Service{store: store, auth: auth}
+}
+
+func (s *Service) admin(token string) (service.User, error) {
+	user, err := s.auth.Authenticate(token)
+	if err != nil {
+		return service.User{}, fmt.Errorf("%w: %v", service.ErrUnauthenticated, err)
+	}
+
+	if err := user.Need(service.ScopeAdmin); err != nil {
+		return service.User{}, err
+	}
+
+	return user, nil
+}
+
+type CreateRequest struct {
+	Token  string // of the caller
+	Name   string
+	Scopes []service.Scope
+	TTL    time.Duration // 0 if the new token does not expire
+}
+
+type CreateResponse struct {
+	Secret string // the new token, it can not be shown again
+	Info   Token
+}
+
+func (s *Service) Create(request *CreateRequest, response *CreateResponse) error {
+	user, err := s.admin(request.Token)
+	if err != nil {
+		return err
+	}
+
+	// a token can only hand out what it is allowed itself
+	for _, scope := range request.Scopes {
+		if err := user.Need(scope); err != nil {
+			return fmt.Errorf("cannot grant %s scope: %w", scope, err)
+		}
+	}
+
+	secret, token, err := s.store.Create(user.ID, request.Name, request.Scopes, request.TTL)
+	if err != nil {
+		return err
+	}
+
+	response.Secret = secret
+	response.Info = token
+	return nil
+}
+
+type ListRequest struct {
+	Token string
+}
+
+type ListResponse struct {
+	Tokens []Token
+}
+
+func (s *Service) List(request *ListRequest, response *ListResponse) error {
+	user, err := s.admin(request.Token)
+	if err != nil {
+		return err
+	}
+
+	response.Tokens, err = s.store.List(user.ID)
+	return err
+}
+
+type RevokeRequest struct {
+	Token string
+	ID    string
+}
+
+type RevokeResponse struct {
+}
+
+func (s *Service) Revoke(request *RevokeRequest, _ *RevokeResponse) error {
+	user, err := s.admin(request.Token)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Revoke(user.ID, request.ID)
+}
@@ -0,0 +1,82 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/eqr/transferit/app/service"
+)
+
+// callers authenticates the token equal to the key of the user
+type callers map[string]service.User
+
+func (c callers) Authenticate(token string) (service.User, error) {
+	user, ok := c[token]
+	if !ok {
+		return service.User{}, fmt.Errorf("unknown token %s", token)
+	}
+
+	return user, nil
+}
+
+func (c callers) Login(login string, _ string) (string, error) {
+	return login, nil
+}
+
+func (c callers) Lookup(login string) (service.User, error) {
+	return c.Authenticate(login)
+}
+
+func TestCreateScopes(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "tokens.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := func(scopes ...service.Scope) service.User {
+		return service.User{ID: 1, Login: "alice", Scopes: scopes}
+	}
+
+	srv := NewService(store, callers{
+		"login":        user(),
+		"admin":        user(service.ScopeAdmin),
+		"admin-upload": user(service.ScopeAdmin, service.ScopeUpload),
+		"upload":       user(service.ScopeUpload),
+	})
+
+	tests := []struct {
+		token  string
+		scopes []service.Scope
+		ok     bool
+	}{
+		{"login", service.Scopes, true},
+		{"admin", []service.Scope{service.ScopeAdmin}, true},
+		{"admin", []service.Scope{service.ScopeUpload}, false},
+		{"admin", []service.Scope{service.ScopeAdmin, service.ScopeDownload}, false},
+		{"admin-upload", []service.Scope{service.ScopeUpload}, true},
+		{"admin-upload", []service.Scope{service.ScopeUpload, service.ScopeDownload}, false},
+		{"upload", []service.Scope{service.ScopeUpload}, false},
+	}
+
+	for _, test := range tests {
+		var response CreateResponse
+		err := srv.Create(&CreateRequest{Token: test.token, Name: "test", Scopes: test.scopes}, &response)
+		if (err == nil) != test.ok {
+			t.Errorf("token %s creating %v: got error %v, expected ok %v", test.token, test.scopes, err, test.ok)
+		}
+
+		if err != nil && !errors.Is(err, service.ErrPermissionDenied) {
+			t.Errorf("token %s creating %v: got error %v, expected %v", test.token, test.scopes, err, service.ErrPermissionDenied)
+		}
+	}
+}
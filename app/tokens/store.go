@@ -0,0 +1,204 @@
+package tokens
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/eqr/transferit/app/service"
+	"github.com/google/uuid"
+)
+
+// Prefix tells API tokens from JWTs issued on login
+const Prefix = "tit_"
+
+var tokensBucket = []byte("tokens")
+
+var (
+	ErrNotFound = errors.New("token not found")
+	ErrExpired  = errors.New("token expired")
+)
+
+// Token describes the API token, the token itself is shown only once on creation
+// and only its SHA-256 is stored
+type Token struct {
+	ID        string
+	UserID    uint64
+	Name      string
+	Scopes    []service.Scope
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero if the token does not expire
+}
+
+// Expired reports if the token can not be used anymore
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
+
+// Store keeps API tokens in the db, they are indexed by the hash
+type Store struct {
+	db *bolt.DB
+}
+
+func NewStore(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(tokensBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot validate tokens bucket: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func hash(plain string) []byte {
+	sum := sha256.Sum256([]byte(plain))
+	return sum[:]
+}
+
+// Create issues the token for the user, ttl 0 means the token does not expire.
+// It returns the token to show to the user and its description.
+func (s *Store) Create(userID uint64, name string, scopes []service.Scope, ttl time.Duration) (string, Token, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", Token{}, fmt.Errorf("token name is required")
+	}
+
+	if err := validateScopes(scopes); err != nil {
+		return "", Token{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", Token{}, fmt.Errorf("cannot generate token: %w", err)
+	}
+
+	plain := Prefix + base64.RawURLEncoding.EncodeToString(secret)
+	token := Token{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+
+	if ttl > 0 {
+		token.ExpiresAt = token.CreatedAt.Add(ttl)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(token); err != nil {
+		return "", Token{}, fmt.Errorf("error encoding token: %w", err)
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).Put(hash(plain), buf.Bytes())
+	})
+	if err != nil {
+		return "", Token{}, fmt.Errorf("cannot save token: %w", err)
+	}
+
+	return plain, token, nil
+}
+
+// List returns tokens of the user, expired ones included
+func (s *Store) List(userID uint64) ([]Token, error) {
+	var tokens []Token
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).ForEach(func(k, v []byte) error {
+			var token Token
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&token); err != nil {
+				return fmt.Errorf("error decoding token: %w", err)
+			}
+
+			if token.UserID == userID {
+				tokens = append(tokens, token)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes the token of the user
+func (s *Store) Revoke(userID uint64, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tokensBucket)
+
+		var key []byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var token Token
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&token); err != nil {
+				return fmt.Errorf("error decoding token: %w", err)
+			}
+
+			if token.ID == id && token.UserID == userID {
+				key = k
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if key == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+// Authenticate finds the token which is not expired
+func (s *Store) Authenticate(plain string) (Token, error) {
+	var token Token
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(tokensBucket).Get(hash(plain))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&token)
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	if token.Expired(time.Now()) {
+		return Token{}, fmt.Errorf("%w: %s", ErrExpired, token.Name)
+	}
+
+	return token, nil
+}
+
+func validateScopes(scopes []service.Scope) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	for _, scope := range scopes {
+		known := false
+		for _, s := range service.Scopes {
+			known = known || s == scope
+		}
+
+		if !known {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	return nil
+}